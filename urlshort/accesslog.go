@@ -0,0 +1,116 @@
+package urlshort
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// AccessLog returns an http.Handler passing the requests to h and
+// writing to out a line for each of them, with a JSON object like:
+//
+//	{"time":"2019-01-02T15:04:05.123Z","remote":"10.0.0.1:51234","method":"GET",
+//	 "host":"go.example.com","path":"/gh/golang/go","rule":"/gh/:user/:repo",
+//	 "status":302,"bytes":0,"duration_ms":0.42}
+//
+// rule is the path of the redirect matching the request,
+// omitted if the request didn't match any.
+func AccessLog(out io.Writer, h http.Handler) http.Handler {
+	var mu sync.Mutex
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := now()
+
+		r, info := withRequestInfo(r)
+		sw := &statusWriter{ResponseWriter: w}
+		h.ServeHTTP(sw, r)
+
+		if sw.status == 0 {
+			sw.status = http.StatusOK
+		}
+
+		line, err := json.Marshal(accessLogEntry{
+			Time:     start.UTC().Format(time.RFC3339Nano),
+			Remote:   r.RemoteAddr,
+			Method:   r.Method,
+			Host:     r.Host,
+			Path:     r.URL.Path,
+			Rule:     info.rule,
+			Status:   sw.status,
+			Bytes:    sw.bytes,
+			Duration: float64(now().Sub(start)) / float64(time.Millisecond),
+		})
+		if err != nil {
+			return
+		}
+
+		mu.Lock()
+		out.Write(append(line, '\n'))
+		mu.Unlock()
+	})
+}
+
+type accessLogEntry struct {
+	Time     string  `json:"time"`
+	Remote   string  `json:"remote"`
+	Method   string  `json:"method"`
+	Host     string  `json:"host"`
+	Path     string  `json:"path"`
+	Rule     string  `json:"rule,omitempty"`
+	Status   int     `json:"status"`
+	Bytes    int     `json:"bytes"`
+	Duration float64 `json:"duration_ms"`
+}
+
+// requestInfo collects what the handlers found out about
+// a request, to be reported once it has been served
+type requestInfo struct {
+	rule string
+}
+
+type requestInfoKey struct{}
+
+// withRequestInfo returns the requestInfo of r, attaching a
+// new one to a copy of r if it has none yet
+func withRequestInfo(r *http.Request) (*http.Request, *requestInfo) {
+	if info, ok := r.Context().Value(requestInfoKey{}).(*requestInfo); ok {
+		return r, info
+	}
+
+	info := &requestInfo{}
+	return r.WithContext(context.WithValue(r.Context(), requestInfoKey{}, info)), info
+}
+
+// matched records that r matched the redirect defined for rule
+func matched(r *http.Request, rule string) {
+	if info, ok := r.Context().Value(requestInfoKey{}).(*requestInfo); ok {
+		info.rule = rule
+	}
+}
+
+// statusWriter is an http.ResponseWriter recording
+// the status code and the size of the response
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += n
+	return n, err
+}
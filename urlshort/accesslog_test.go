@@ -0,0 +1,42 @@
+package urlshort
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAccessLog(t *testing.T) {
+	h, err := DataHandler([]byte(`[{"path": "/gh/:user", "url": "https://github.com/:user"}]`), "json", http.NotFoundHandler())
+	if err != nil {
+		t.Fatalf("DataHandler failed with error %v\n", err)
+	}
+
+	var out bytes.Buffer
+	logged := AccessLog(&out, h)
+
+	for _, path := range []string{"/gh/golang", "/missing"} {
+		logged.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	dec := json.NewDecoder(&out)
+	for _, expected := range []accessLogEntry{
+		{Method: "GET", Path: "/gh/golang", Rule: "/gh/:user", Status: http.StatusFound},
+		{Method: "GET", Path: "/missing", Status: http.StatusNotFound},
+	} {
+		var entry accessLogEntry
+		if err := dec.Decode(&entry); err != nil {
+			t.Fatalf("Cannot decode log line: %v\n", err)
+		}
+
+		if entry.Method != expected.Method || entry.Path != expected.Path ||
+			entry.Rule != expected.Rule || entry.Status != expected.Status {
+			t.Errorf("Expected %+v, got %+v\n", expected, entry)
+		}
+		if entry.Time == "" || entry.Duration < 0 {
+			t.Errorf("Missing time or duration in %+v\n", entry)
+		}
+	}
+}
@@ -0,0 +1,342 @@
+package urlshort
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Link is a redirect along with its clicks, and the
+// ones of each of its targets, as returned by the admin API
+type Link struct {
+	Redirect
+	Clicks   int64            `json:"clicks"`
+	Variants map[string]int64 `json:"variants,omitempty"`
+}
+
+// AdminHandler will return an http.HandlerFunc (which also
+// implements http.Handler) serving a JSON API to manage the
+// redirects of store:
+//
+//	GET    /links         lists all the links
+//	GET    /links/<path>  returns the link for /<path>
+//	PUT    /links/<path>  creates or replaces the link for /<path>
+//	DELETE /links/<path>  removes the link for /<path>
+//
+// The links are JSON objects in the same format used by DataHandler,
+// plus the clicks read from counter, if not nil. PUT takes the same
+// object, without the path. onChange, if not nil, is called with the
+// path of each link created, replaced or removed.
+//
+// If store is an *AuditStore the changes are recorded as made by the
+// Actor of each request, and the history of the links is served too:
+//
+//	GET    /history/<path>            lists the changes of /<path>
+//	POST   /history/<path>?version=N  rolls /<path> back to version N
+func AdminHandler(store WritableStore, counter Counter, onChange func(path string)) http.HandlerFunc {
+	a := &admin{
+		store:    store,
+		counter:  counter,
+		onChange: onChange,
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/links" || r.URL.Path == "/links/" {
+			if r.Method != http.MethodGet {
+				w.Header().Set("Allow", http.MethodGet)
+				http.Error(w, "405 method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			a.list(w)
+			return
+		}
+
+		if strings.HasPrefix(r.URL.Path, "/history/") {
+			a.history(w, r, strings.TrimPrefix(r.URL.Path, "/history"))
+			return
+		}
+
+		if !strings.HasPrefix(r.URL.Path, "/links/") {
+			http.NotFound(w, r)
+			return
+		}
+		path := strings.TrimPrefix(r.URL.Path, "/links")
+
+		switch r.Method {
+		case http.MethodGet:
+			a.get(w, path)
+		case http.MethodPut:
+			a.put(w, r, path)
+		case http.MethodDelete:
+			a.delete(w, r, path)
+		default:
+			w.Header().Set("Allow", "GET, PUT, DELETE")
+			http.Error(w, "405 method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// RequireToken returns an http.Handler passing to h only the
+// requests with an "Authorization: Bearer <token>" header,
+// answering 401 Unauthorized to the others. Their Actor is "token".
+func RequireToken(token string, h http.Handler) http.Handler {
+	return RequireTokens(map[string]string{"token": token}, h)
+}
+
+// RequireTokens is like RequireToken with several tokens, mapped
+// to the names of their owners: the Actor of each request is the
+// name of its token.
+func RequireTokens(tokens map[string]string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		given := r.Header.Get("Authorization")
+
+		owner, found := "", false
+		for name, token := range tokens {
+			// all of them, so the time taken doesn't tell which one matched
+			if token != "" && subtle.ConstantTimeCompare([]byte(given), []byte("Bearer "+token)) == 1 {
+				owner, found = name, true
+			}
+		}
+		if !found {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="urlshort"`)
+			http.Error(w, "401 unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		h.ServeHTTP(w, authenticated(r, owner))
+	})
+}
+
+// BasicAuth returns an http.Handler passing to h only the requests
+// carrying user and password with HTTP basic authentication, asking
+// the browser for them on the others. Their Actor is user.
+func BasicAuth(user, password string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, p, _ := r.BasicAuth()
+		userOK := subtle.ConstantTimeCompare([]byte(u), []byte(user)) == 1
+		passwordOK := subtle.ConstantTimeCompare([]byte(p), []byte(password)) == 1
+		if !userOK || !passwordOK {
+			w.Header().Set("WWW-Authenticate", `Basic realm="urlshort", charset="UTF-8"`)
+			http.Error(w, "401 unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		h.ServeHTTP(w, authenticated(r, user))
+	})
+}
+
+type identityKey struct{}
+
+// authenticated returns a copy of r made by identity,
+// whose credentials have been checked
+func authenticated(r *http.Request, identity string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), identityKey{}, identity))
+}
+
+// CountClicks returns redirect along with its clicks, and the
+// ones of each of its targets, read from counter
+func CountClicks(redirect Redirect, counter Counter) (Link, error) {
+	link := Link{Redirect: redirect}
+
+	var err error
+	if link.Clicks, err = counter.Count(redirect.Path); err != nil {
+		return link, err
+	}
+
+	for i, t := range redirect.Targets {
+		if link.Variants == nil {
+			link.Variants = make(map[string]int64, len(redirect.Targets))
+		}
+
+		name := t.name(i)
+		if link.Variants[name], err = counter.Count(variantKey(redirect.Path, name)); err != nil {
+			return link, err
+		}
+	}
+
+	return link, nil
+}
+
+type admin struct {
+	store    WritableStore
+	counter  Counter
+	onChange func(path string)
+}
+
+func (a *admin) list(w http.ResponseWriter) {
+	redirects, err := a.store.List()
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+
+	links := make([]Link, 0, len(redirects))
+	for _, redirect := range redirects {
+		link, err := a.link(redirect)
+		if err != nil {
+			storeError(w, err)
+			return
+		}
+		links = append(links, link)
+	}
+
+	writeJSON(w, http.StatusOK, links)
+}
+
+func (a *admin) get(w http.ResponseWriter, path string) {
+	redirect, err := a.store.Get(path)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+
+	link, err := a.link(redirect)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, link)
+}
+
+func (a *admin) put(w http.ResponseWriter, r *http.Request, path string) {
+	var redirect Redirect
+	if err := json.NewDecoder(r.Body).Decode(&redirect); err != nil {
+		http.Error(w, "invalid link: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	redirect.Path = path
+
+	if err := redirect.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	status := http.StatusOK
+	if _, err := a.store.Get(path); err == ErrNotFound {
+		status = http.StatusCreated
+	} else if err != nil {
+		storeError(w, err)
+		return
+	}
+
+	if err := a.storeFor(r).Put(redirect); err != nil {
+		storeError(w, err)
+		return
+	}
+	a.changed(path)
+
+	// the store may have changed it, collapsing its chain
+	redirect, err := a.store.Get(path)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+
+	link, err := a.link(redirect)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+
+	writeJSON(w, status, link)
+}
+
+func (a *admin) delete(w http.ResponseWriter, r *http.Request, path string) {
+	if err := a.storeFor(r).Delete(path); err != nil {
+		storeError(w, err)
+		return
+	}
+	a.changed(path)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *admin) history(w http.ResponseWriter, r *http.Request, path string) {
+	audit, ok := a.store.(*AuditStore)
+	if !ok {
+		http.Error(w, "404 no audit log", http.StatusNotFound)
+		return
+	}
+
+	changes, err := audit.History(path)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, changes)
+	case http.MethodPost:
+		version, err := strconv.Atoi(r.URL.Query().Get("version"))
+		if err != nil || version < 1 || version > len(changes) {
+			http.Error(w, "invalid version, the link has "+strconv.Itoa(len(changes)), http.StatusBadRequest)
+			return
+		}
+
+		if err := Rollback(a.storeFor(r), changes, version); err != nil {
+			storeError(w, err)
+			return
+		}
+		a.changed(path)
+
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "405 method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// storeFor returns the store recording the changes made by r
+func (a *admin) storeFor(r *http.Request) WritableStore {
+	if audit, ok := a.store.(*AuditStore); ok {
+		return audit.As(Actor(r)).Claiming(r.Header.Get("X-Actor"))
+	}
+	return a.store
+}
+
+func (a *admin) link(redirect Redirect) (Link, error) {
+	if a.counter == nil {
+		return Link{Redirect: redirect}, nil
+	}
+	return CountClicks(redirect, a.counter)
+}
+
+func (a *admin) changed(path string) {
+	if a.onChange != nil {
+		a.onChange(path)
+	}
+}
+
+func storeError(w http.ResponseWriter, err error) {
+	switch err.(type) {
+	case *ChainError, *PatternError:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case *PathConflictError:
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	switch err {
+	case ErrNotFound:
+		http.Error(w, "404 link not found", http.StatusNotFound)
+	case ErrUnavailable:
+		http.Error(w, "503 "+err.Error(), http.StatusServiceUnavailable)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	enc.Encode(v)
+}
@@ -0,0 +1,170 @@
+package urlshort
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAdminAPI(t *testing.T) {
+	dir, err := ioutil.TempDir("", "urlshort")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "redirects.yml")
+	writeFile(t, path, "- path: /a\n  url: https://a.example.com\n")
+
+	store, err := NewFileStore(path, "")
+	if err != nil {
+		t.Fatalf("NewFileStore failed with error %v\n", err)
+	}
+
+	counter := NewMemoryCounter()
+	counter.Incr("/a")
+
+	var changed []string
+	h := AdminHandler(store, counter, func(path string) {
+		changed = append(changed, path)
+	})
+	server := httptest.NewServer(RequireToken("secret", h))
+	defer server.Close()
+
+	client := NewAPIClient(server.URL, "secret")
+
+	link, err := client.Link("/a")
+	if err != nil {
+		t.Fatalf("Link failed with error %v\n", err)
+	}
+	if link.URL != "https://a.example.com" || link.Clicks != 1 {
+		t.Errorf("Expected /a with 1 click, got %+v\n", link)
+	}
+
+	if err := client.Put(Redirect{Path: "/b", URL: "https://b.example.com", Status: 301}); err != nil {
+		t.Fatalf("Put failed with error %v\n", err)
+	}
+	if err := client.Put(Redirect{Path: "/c", URL: "relative"}); err == nil {
+		t.Errorf("Expected Put to fail on an invalid link\n")
+	}
+	for _, path := range []string{"/docs/*/x", "/docs*", "/gh/:1st", "/gh/:/x"} {
+		err := client.Put(Redirect{Path: path, URL: "https://example.com"})
+		if err == nil || !strings.Contains(err.Error(), "invalid") {
+			t.Errorf("Expected Put to fail on the invalid path %s, got %v\n", path, err)
+		}
+	}
+
+	if err := client.Delete("/a"); err != nil {
+		t.Fatalf("Delete failed with error %v\n", err)
+	}
+	if err := client.Delete("/a"); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound deleting a missing link, got %v\n", err)
+	}
+
+	redirects, err := client.List()
+	if err != nil {
+		t.Fatalf("List failed with error %v\n", err)
+	}
+	if len(redirects) != 1 || redirects[0].Path != "/b" || redirects[0].Status != 301 {
+		t.Errorf("Expected only /b, got %+v\n", redirects)
+	}
+
+	// the changes are written to the file
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "https://b.example.com") || strings.Contains(string(data), "https://a.example.com") {
+		t.Errorf("Unexpected file content:\n%s\n", data)
+	}
+
+	if strings.Join(changed, ",") != "/b,/a" {
+		t.Errorf("Expected changes to /b and /a, got %v\n", changed)
+	}
+}
+
+func TestAdminAPIPathConflicts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "urlshort")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "redirects.yml")
+	writeFile(t, path, "- path: /gh/:a\n  url: https://github.com/:a\n")
+
+	store, err := NewFileStore(path, "")
+	if err != nil {
+		t.Fatalf("NewFileStore failed with error %v\n", err)
+	}
+	h := AdminHandler(store, nil, nil)
+
+	// the file would no longer be loadable
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("PUT", "/links/gh/:b", strings.NewReader(`{"url": "https://github.com/:b"}`)))
+	if rec.Code != http.StatusConflict {
+		t.Errorf("Expected status %v putting /gh/:b, got %v: %s\n", http.StatusConflict, rec.Code, rec.Body.String())
+	}
+
+	if _, err := NewFileHandler(path, "", http.NotFoundHandler()); err != nil {
+		t.Errorf("Expected the file to be left loadable, got %v\n", err)
+	}
+}
+
+func TestAdminAPIExactPaths(t *testing.T) {
+	store := ExactPaths(newMemoryStore())
+	admin := AdminHandler(store, nil, nil)
+	h := StoreHandler(store, http.NotFoundHandler(), nil)
+
+	for path, status := range map[string]int{
+		"/gh/:user": http.StatusBadRequest,
+		"/docs/*":   http.StatusBadRequest,
+		"/gh":       http.StatusCreated,
+	} {
+		body := `{"url": "https://github.com/"}`
+		rec := httptest.NewRecorder()
+		admin.ServeHTTP(rec, httptest.NewRequest("PUT", "/links"+path, strings.NewReader(body)))
+		if rec.Code != status {
+			t.Errorf("Expected status %v putting %s, got %v: %s\n", status, path, rec.Code, rec.Body.String())
+		}
+	}
+
+	// the patterns refused would never have matched
+	for path, status := range map[string]int{
+		"/gh/golang": http.StatusNotFound,
+		"/docs/x":    http.StatusNotFound,
+		"/gh":        http.StatusFound,
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		if rec.Code != status {
+			t.Errorf("Expected status %v for %s, got %v\n", status, path, rec.Code)
+		}
+	}
+}
+
+func TestRequireToken(t *testing.T) {
+	h := RequireToken("secret", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for header, status := range map[string]int{
+		"":              http.StatusUnauthorized,
+		"Bearer wrong":  http.StatusUnauthorized,
+		"secret":        http.StatusUnauthorized,
+		"Bearer secret": http.StatusOK,
+	} {
+		req := httptest.NewRequest("GET", "/links", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != status {
+			t.Errorf("Expected status %v for %q, got %v\n", status, header, rec.Code)
+		}
+	}
+}
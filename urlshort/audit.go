@@ -0,0 +1,249 @@
+package urlshort
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Change is a change made to a link, as recorded in the audit log
+type Change struct {
+	Time    time.Time `json:"time"`
+	Actor   string    `json:"actor"`
+	Claimed string    `json:"claimed,omitempty"` // who the client said it was, not verified
+	Action  string    `json:"action"`            // create, update or delete
+	Path    string    `json:"path"`
+	Old     *Redirect `json:"old,omitempty"` // nil if created
+	New     *Redirect `json:"new,omitempty"` // nil if deleted
+}
+
+// History is implemented by the stores
+// keeping track of the changes of their links
+type History interface {
+	// History returns the changes of the link for path, oldest first
+	History(path string) ([]Change, error)
+}
+
+// AuditLog is an append-only log of the changes made to the links,
+// kept in a file with a JSON object per line.
+type AuditLog struct {
+	mu   sync.Mutex
+	path string
+	f    *os.File
+}
+
+// OpenAuditLog opens the audit log in the file at path,
+// creating it if it doesn't exist.
+func OpenAuditLog(path string) (*AuditLog, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AuditLog{path: path, f: f}, nil
+}
+
+// Record appends c to the log
+func (l *AuditLog) Record(c Change) error {
+	line, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// a single write, so that the lines of concurrent
+	// processes appending to the same file don't mix
+	_, err = l.f.Write(append(line, '\n'))
+	return err
+}
+
+// History returns the changes of the link for path, oldest first
+func (l *AuditLog) History(path string) ([]Change, error) {
+	f, err := os.Open(l.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	changes := []Change{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for n := 1; scanner.Scan(); n++ {
+		var c Change
+		if err := json.Unmarshal(scanner.Bytes(), &c); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", l.path, n, err)
+		}
+
+		if c.Path == path {
+			changes = append(changes, c)
+		}
+	}
+
+	return changes, scanner.Err()
+}
+
+// Close closes the file of the log
+func (l *AuditLog) Close() error {
+	return l.f.Close()
+}
+
+// AuditStore is a WritableStore recording in an AuditLog
+// each change made to the links of another store.
+type AuditStore struct {
+	WritableStore
+	log     *AuditLog
+	actor   string
+	claimed string
+
+	normalization Normalization
+}
+
+// Audit returns an AuditStore recording the changes made to the
+// links of store in log, as made by actor.
+func Audit(store WritableStore, log *AuditLog, actor string) *AuditStore {
+	return &AuditStore{WritableStore: store, log: log, actor: actor}
+}
+
+// As returns a copy of s recording the changes as made by actor,
+// sharing the store and the log.
+func (s *AuditStore) As(actor string) *AuditStore {
+	return &AuditStore{WritableStore: s.WritableStore, log: s.log, actor: actor, normalization: s.normalization}
+}
+
+// Claiming returns a copy of s recording along with the changes
+// that their author claimed to be someone, whose identity has not
+// been verified, like the one given by the clients of the admin API.
+func (s *AuditStore) Claiming(claimed string) *AuditStore {
+	clone := *s
+	clone.claimed = claimed
+	return &clone
+}
+
+// Normalizing returns a copy of s looking up the history of the
+// links with their paths normalized as described by n, like the
+// ones of a store returned by NormalizeStore, which are recorded.
+func (s *AuditStore) Normalizing(n Normalization) *AuditStore {
+	clone := *s
+	clone.normalization = n
+	return &clone
+}
+
+// Put creates or replaces redirect, recording the change
+func (s *AuditStore) Put(redirect Redirect) error {
+	old, err := s.previous(redirect.Path)
+	if err != nil {
+		return err
+	}
+
+	if err := s.WritableStore.Put(redirect); err != nil {
+		return err
+	}
+
+	// the store may have changed it, collapsing its chain
+	if stored, err := s.WritableStore.Get(redirect.Path); err == nil {
+		redirect = stored
+	}
+
+	action := "update"
+	if old == nil {
+		action = "create"
+	}
+
+	return s.record(action, redirect.Path, old, &redirect)
+}
+
+// Delete removes the redirect for path, recording the change
+func (s *AuditStore) Delete(path string) error {
+	old, err := s.previous(path)
+	if err != nil {
+		return err
+	}
+
+	if err := s.WritableStore.Delete(path); err != nil {
+		return err
+	}
+
+	// the path of the link removed, maybe spelled differently
+	if old != nil {
+		path = old.Path
+	}
+	return s.record("delete", path, old, nil)
+}
+
+// History returns the changes of the link for path, oldest first
+func (s *AuditStore) History(path string) ([]Change, error) {
+	if normalized, err := s.normalization.redirectPath(path); err == nil {
+		path = normalized
+	}
+	return s.log.History(path)
+}
+
+// previous returns the redirect for path, nil if it doesn't exist
+func (s *AuditStore) previous(path string) (*Redirect, error) {
+	redirect, err := s.WritableStore.Get(path)
+	if err == ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &redirect, nil
+}
+
+func (s *AuditStore) record(action, path string, before, after *Redirect) error {
+	err := s.log.Record(Change{
+		Time:    now().UTC(),
+		Actor:   s.actor,
+		Claimed: s.claimed,
+		Action:  action,
+		Path:    path,
+		Old:     before,
+		New:     after,
+	})
+	if err != nil {
+		return fmt.Errorf("%s changed but not recorded in the audit log: %v", path, err)
+	}
+	return nil
+}
+
+// Rollback brings the link described by changes back to the state
+// it had after the change number version, starting from 1: the
+// redirect is stored again, or removed if that change deleted it.
+func Rollback(store WritableStore, changes []Change, version int) error {
+	if version < 1 || version > len(changes) {
+		return fmt.Errorf("no version %d, the link has %d", version, len(changes))
+	}
+
+	c := changes[version-1]
+	if c.New == nil {
+		if err := store.Delete(c.Path); err != nil && err != ErrNotFound {
+			return err
+		}
+		return nil
+	}
+
+	return store.Put(*c.New)
+}
+
+// Actor returns who made r, as verified by the server: the user or
+// the owner of the token checked by BasicAuth or RequireTokens, else
+// the client address. The X-Actor header sent by APIClient is only
+// a claim, recorded apart (see AuditStore.Claiming).
+func Actor(r *http.Request) string {
+	if identity, ok := r.Context().Value(identityKey{}).(string); ok {
+		return identity
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,186 @@
+package urlshort
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAuditStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "urlshort")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	l, err := OpenAuditLog(filepath.Join(dir, "audit.log"))
+	if err != nil {
+		t.Fatalf("OpenAuditLog failed with error %v\n", err)
+	}
+	defer l.Close()
+
+	store := Audit(newMemoryStore(), l, "alice")
+	store.Put(Redirect{Path: "/a", URL: "https://one.example.com"})
+	store.As("bob").Put(Redirect{Path: "/a", URL: "https://two.example.com"})
+	store.Put(Redirect{Path: "/b", URL: "https://b.example.com"})
+	store.Delete("/a")
+
+	changes, err := store.History("/a")
+	if err != nil {
+		t.Fatalf("History failed with error %v\n", err)
+	}
+	if len(changes) != 3 {
+		t.Fatalf("Expected 3 changes of /a, got %+v\n", changes)
+	}
+	for i, expected := range []struct{ actor, action, before, after string }{
+		{"alice", "create", "", "https://one.example.com"},
+		{"bob", "update", "https://one.example.com", "https://two.example.com"},
+		{"alice", "delete", "https://two.example.com", ""},
+	} {
+		c := changes[i]
+		var before, after string
+		if c.Old != nil {
+			before = c.Old.URL
+		}
+		if c.New != nil {
+			after = c.New.URL
+		}
+		if c.Actor != expected.actor || c.Action != expected.action || before != expected.before || after != expected.after {
+			t.Errorf("Expected change %d to be %+v, got %+v\n", i+1, expected, c)
+		}
+	}
+
+	if err := Rollback(store, changes, 1); err != nil {
+		t.Fatalf("Rollback failed with error %v\n", err)
+	}
+	if redirect, _ := store.Get("/a"); redirect.URL != "https://one.example.com" {
+		t.Errorf("Expected /a to be back to its first version, got %v\n", redirect.URL)
+	}
+	if changes, _ := store.History("/a"); len(changes) != 4 || changes[3].Action != "create" {
+		t.Errorf("Expected the rollback to be recorded, got %+v\n", changes)
+	}
+
+	if err := Rollback(store, changes, 4); err == nil {
+		t.Errorf("Expected Rollback to fail with an unknown version\n")
+	}
+}
+
+func TestAuditStoreNormalized(t *testing.T) {
+	dir, err := ioutil.TempDir("", "urlshort")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	l, err := OpenAuditLog(filepath.Join(dir, "audit.log"))
+	if err != nil {
+		t.Fatalf("OpenAuditLog failed with error %v\n", err)
+	}
+	defer l.Close()
+
+	n := Normalization{FoldCase: true, TrailingSlash: true}
+	store := Audit(NormalizeStore(newMemoryStore(), n), l, "alice").Normalizing(n)
+	store.Put(Redirect{Path: "/Docs", URL: "https://example.com/docs"})
+	store.Delete("/docs/")
+
+	// the changes are recorded and looked up with the stored path
+	for _, path := range []string{"/docs", "/DOCS/", "/Docs"} {
+		changes, err := store.History(path)
+		if err != nil {
+			t.Fatalf("History failed with error %v\n", err)
+		}
+		if len(changes) != 2 || changes[0].Path != "/docs" || changes[1].Path != "/docs" || changes[1].Action != "delete" {
+			t.Errorf("Expected the creation and deletion of /docs for %s, got %+v\n", path, changes)
+		}
+	}
+}
+
+func TestAdminHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "urlshort")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	l, err := OpenAuditLog(filepath.Join(dir, "audit.log"))
+	if err != nil {
+		t.Fatalf("OpenAuditLog failed with error %v\n", err)
+	}
+	defer l.Close()
+
+	store := Audit(newMemoryStore(), l, "")
+	server := httptest.NewServer(RequireTokens(map[string]string{"alice": "a", "bob": "b"}, AdminHandler(store, nil, nil)))
+	defer server.Close()
+
+	// the actor is the owner of the token, not who the client claims to be
+	client := NewAPIClient(server.URL, "a").As("carol")
+	client.Put(Redirect{Path: "/a", URL: "https://one.example.com"})
+	client.Put(Redirect{Path: "/a", URL: "https://two.example.com"})
+
+	changes, err := client.History("/a")
+	if err != nil {
+		t.Fatalf("History failed with error %v\n", err)
+	}
+	if len(changes) != 2 || changes[0].Actor != "alice" || changes[0].Claimed != "carol" || changes[1].New.URL != "https://two.example.com" {
+		t.Errorf("Expected 2 changes by alice claiming to be carol, got %+v\n", changes)
+	}
+
+	post := func(path, token string) (*http.Response, error) {
+		r, err := http.NewRequest(http.MethodPost, server.URL+path, nil)
+		if err != nil {
+			return nil, err
+		}
+		r.Header.Set("Authorization", "Bearer "+token)
+		r.Header.Set("X-Actor", "mallory")
+		return http.DefaultClient.Do(r)
+	}
+
+	resp, err := post("/history/a?version=1", "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("Expected 204 rolling back, got %v\n", resp.StatusCode)
+	}
+	if redirect, _ := store.Get("/a"); redirect.URL != "https://one.example.com" {
+		t.Errorf("Expected /a to be rolled back, got %v\n", redirect.URL)
+	}
+	if changes, _ := client.History("/a"); len(changes) != 3 || changes[2].Actor != "bob" || changes[2].Claimed != "mallory" {
+		t.Errorf("Expected the rollback to be recorded as made by bob, got %+v\n", changes)
+	}
+
+	resp, err = post("/history/a?version=9", "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 with an unknown version, got %v\n", resp.StatusCode)
+	}
+}
+
+func TestActor(t *testing.T) {
+	var actor string
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		actor = Actor(r)
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "192.0.2.1:1234"
+	r.Header.Set("X-Actor", "mallory")
+	r.SetBasicAuth("mallory", "")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	if actor != "192.0.2.1" {
+		t.Errorf("Expected the client address without verified credentials, got %s\n", actor)
+	}
+
+	r.SetBasicAuth("admin", "secret")
+	BasicAuth("admin", "secret", h).ServeHTTP(httptest.NewRecorder(), r)
+	if actor != "admin" {
+		t.Errorf("Expected the user checked by BasicAuth, got %s\n", actor)
+	}
+}
@@ -0,0 +1,153 @@
+package urlshort
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// BoltStore is a WritableStore keeping the redirects in a bucket of
+// an embedded bbolt database, as JSON objects in the same format
+// used by DataHandler keyed by path. It also implements Counter,
+// keeping the clicks in a second bucket named like the first one
+// plus ":clicks".
+type BoltStore struct {
+	db     *bolt.DB
+	bucket []byte
+	clicks []byte
+}
+
+// NewBoltStore returns a BoltStore using the bucket
+// named bucket of db, creating it if needed.
+func NewBoltStore(db *bolt.DB, bucket string) (*BoltStore, error) {
+	s := &BoltStore{
+		db:     db,
+		bucket: []byte(bucket),
+		clicks: []byte(bucket + ":clicks"),
+	}
+
+	err := db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(s.bucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(s.clicks)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Get returns the redirect stored for path
+func (s *BoltStore) Get(path string) (Redirect, error) {
+	var redirect Redirect
+	err := s.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(s.bucket).Get([]byte(path))
+		if value == nil {
+			return ErrNotFound
+		}
+
+		var err error
+		redirect, err = decodeBoltValue(path, value)
+		return err
+	})
+
+	return redirect, err
+}
+
+// List returns all the redirects in the bucket, ordered by path
+func (s *BoltStore) List() ([]Redirect, error) {
+	var redirects []Redirect
+	err := s.db.View(func(tx *bolt.Tx) error {
+		// the keys are iterated in byte order
+		return tx.Bucket(s.bucket).ForEach(func(k, v []byte) error {
+			redirect, err := decodeBoltValue(string(k), v)
+			if err != nil {
+				return err
+			}
+			redirects = append(redirects, redirect)
+			return nil
+		})
+	})
+
+	return redirects, err
+}
+
+// Put stores redirect in the bucket
+func (s *BoltStore) Put(redirect Redirect) error {
+	if err := redirect.validate(); err != nil {
+		return err
+	}
+
+	value, err := json.Marshal(redirect)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(s.bucket).Put([]byte(redirect.Path), value)
+	})
+}
+
+// Delete removes the redirect for path from the bucket
+func (s *BoltStore) Delete(path string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(s.bucket)
+		if b.Get([]byte(path)) == nil {
+			return ErrNotFound
+		}
+		return b.Delete([]byte(path))
+	})
+}
+
+// Incr increments the clicks of path
+func (s *BoltStore) Incr(path string) (int64, error) {
+	var clicks int64
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(s.clicks)
+
+		var err error
+		if clicks, err = decodeBoltCount(b.Get([]byte(path))); err != nil {
+			return err
+		}
+		clicks++
+
+		return b.Put([]byte(path), []byte(strconv.FormatInt(clicks, 10)))
+	})
+
+	return clicks, err
+}
+
+// Count returns the clicks of path
+func (s *BoltStore) Count(path string) (int64, error) {
+	var clicks int64
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		clicks, err = decodeBoltCount(tx.Bucket(s.clicks).Get([]byte(path)))
+		return err
+	})
+
+	return clicks, err
+}
+
+func decodeBoltValue(path string, value []byte) (Redirect, error) {
+	var redirect Redirect
+	if err := json.Unmarshal(value, &redirect); err != nil {
+		return Redirect{}, fmt.Errorf("invalid value for path %s: %v", path, err)
+	}
+	redirect.Path = path
+
+	return redirect, nil
+}
+
+func decodeBoltCount(value []byte) (int64, error) {
+	if value == nil {
+		return 0, nil
+	}
+
+	return strconv.ParseInt(string(value), 10, 64)
+}
@@ -0,0 +1,63 @@
+package urlshort
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestBoltStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "urlshort")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := bolt.Open(filepath.Join(dir, "urlshort.db"), 0644, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	store, err := NewBoltStore(db, "urlshort")
+	if err != nil {
+		t.Fatalf("NewBoltStore failed with error %v\n", err)
+	}
+
+	for _, redirect := range []Redirect{
+		{Path: "/b", URL: "https://b.example.com", OneTime: true},
+		{Path: "/a", URL: "https://a.example.com"},
+	} {
+		if err := store.Put(redirect); err != nil {
+			t.Fatalf("Put failed with error %v\n", err)
+		}
+	}
+
+	redirect, err := store.Get("/b")
+	if err != nil || redirect.URL != "https://b.example.com" || !redirect.OneTime {
+		t.Errorf("Unexpected redirect %+v for /b, error %v\n", redirect, err)
+	}
+
+	redirects, err := store.List()
+	if err != nil || len(redirects) != 2 || redirects[0].Path != "/a" {
+		t.Errorf("Expected /a and /b, got %+v, error %v\n", redirects, err)
+	}
+
+	store.Incr("/a")
+	if clicks, err := store.Incr("/a"); clicks != 2 || err != nil {
+		t.Errorf("Expected 2 clicks, got %v, error %v\n", clicks, err)
+	}
+
+	if err := store.Delete("/a"); err != nil {
+		t.Errorf("Delete failed with error %v\n", err)
+	}
+	if _, err := store.Get("/a"); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound for /a, got %v\n", err)
+	}
+	if err := store.Delete("/a"); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound deleting /a again, got %v\n", err)
+	}
+}
@@ -0,0 +1,315 @@
+package urlshort
+
+import (
+	"encoding/csv"
+	"fmt"
+	"gophercises/link/linkextract"
+	"io"
+	"net/url"
+	"path"
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+// The actions of an import, see PlanImport
+const (
+	ImportCreate    = "create"    // a new link
+	ImportReplace   = "replace"   // an existing link with the same path, overwritten
+	ImportDuplicate = "duplicate" // a link already there, left alone
+	ImportConflict  = "conflict"  // a path already taken by another link, left alone
+	ImportInvalid   = "invalid"   // a link with an error
+)
+
+const maxSlugLength = 40
+
+// ImportOptions customize PlanImport
+type ImportOptions struct {
+	// Paths is how the links without a path get one: "random", the
+	// default, for a random path like /x7Kp2q, or "slug" for a path
+	// derived from their title or URL, like /release-notes
+	Paths string
+
+	// Overwrite replaces the existing links with the same paths
+	// instead of reporting them as conflicts
+	Overwrite bool
+
+	// Normalization is how the paths are normalized by the store the
+	// links are imported in: the paths matching the same requests
+	// once normalized are the same, as the ones of the patterns
+	// differing only by the names of their parameters
+	Normalization Normalization
+}
+
+// ImportResult is what an import does with one of the links
+type ImportResult struct {
+	Redirect Redirect
+	Action   string
+	Existing string // path of the link a duplicate or conflict is about
+	Err      error  // why the link is invalid
+}
+
+func (r ImportResult) String() string {
+	switch r.Action {
+	case ImportDuplicate:
+		return fmt.Sprintf("duplicate %s: already at %s", r.Redirect.URL, r.Existing)
+	case ImportConflict:
+		return fmt.Sprintf("conflict %s: already taken by another link, not replaced", r.Redirect.Path)
+	case ImportInvalid:
+		return fmt.Sprintf("invalid %s: %v", r.Redirect.URL, r.Err)
+	}
+	return fmt.Sprintf("%s %s -> %s", r.Action, r.Redirect.Path, r.Redirect.URL)
+}
+
+// PlanImport returns what importing links next to the existing ones
+// does with each of them, without changing anything: the links
+// without a path get one as described by opts, the ones already
+// there, identical at the same path or with the same URL for a
+// generated path, are duplicates, and the paths already taken by
+// other links, in existing or earlier in links, are conflicts
+// unless opts.Overwrite is true and they are the same once
+// normalized.
+func PlanImport(existing, links []Redirect, opts ImportOptions) ([]ImportResult, error) {
+	if opts.Paths != "" && opts.Paths != "random" && opts.Paths != "slug" {
+		return nil, fmt.Errorf("unknown paths %q, expected random or slug", opts.Paths)
+	}
+
+	n := opts.Normalization
+	byPath := make(map[string]Redirect, len(existing)+len(links))
+	byURL := make(map[string]string, len(existing)+len(links))
+	for _, redirect := range existing {
+		byPath[n.Key(redirect.Path)] = redirect
+		if _, ok := byURL[redirect.URL]; !ok {
+			byURL[redirect.URL] = redirect.Path
+		}
+	}
+	imported := make(map[string]bool)
+
+	results := make([]ImportResult, 0, len(links))
+	for _, redirect := range links {
+		result := ImportResult{Redirect: redirect, Action: ImportCreate}
+
+		if redirect.Path == "" {
+			if at, ok := byURL[redirect.URL]; ok && redirect.URL != "" {
+				result.Action, result.Existing = ImportDuplicate, at
+				results = append(results, result)
+				continue
+			}
+
+			generated, err := newPath(redirect, opts.Paths, func(path string) bool {
+				_, ok := byPath[n.Key(path)]
+				return ok
+			})
+			if err != nil {
+				return nil, err
+			}
+			redirect.Path = generated
+		} else if !strings.HasPrefix(redirect.Path, "/") {
+			redirect.Path = "/" + redirect.Path
+		}
+		result.Redirect = redirect
+
+		if err := redirect.validate(); err != nil {
+			result.Action, result.Err = ImportInvalid, err
+			results = append(results, result)
+			continue
+		}
+
+		key := n.Key(redirect.Path)
+		if other, ok := byPath[key]; ok {
+			// the patterns with other parameter names can't replace them
+			samePath := n.samePath(other.Path, redirect.Path)
+			switch {
+			case samePath && sameRedirect(other, redirect):
+				result.Action, result.Existing = ImportDuplicate, other.Path
+			case samePath && opts.Overwrite && !imported[key]:
+				result.Action = ImportReplace
+			default:
+				result.Action, result.Existing = ImportConflict, other.Path
+			}
+		}
+
+		if result.Action == ImportCreate || result.Action == ImportReplace {
+			byPath[key] = redirect
+			byURL[redirect.URL] = redirect.Path
+			imported[key] = true
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// sameRedirect reports if a and b are the same link, regardless of
+// how their paths, normalized by PlanImport, and their default values
+// are spelled
+func sameRedirect(a, b Redirect) bool {
+	normalize := func(rd Redirect) Redirect {
+		rd.Path = ""
+		rd.Status = rd.status()
+		if rd.Expires != nil {
+			expires := rd.Expires.UTC()
+			rd.Expires = &expires
+		}
+		if len(rd.Targets) == 0 {
+			rd.Targets = nil
+		}
+		if len(rd.Rules) == 0 {
+			rd.Rules = nil
+		}
+		if len(rd.Params) == 0 {
+			rd.Params = nil
+		}
+		return rd
+	}
+
+	return reflect.DeepEqual(normalize(a), normalize(b))
+}
+
+// newPath returns a path for redirect not taken yet
+func newPath(redirect Redirect, paths string, taken func(path string) bool) (string, error) {
+	if paths == "slug" {
+		if slug := slugOf(redirect); slug != "" {
+			candidate := "/" + slug
+			for i := 2; ; i++ {
+				if !taken(candidate) {
+					return candidate, nil
+				}
+				candidate = fmt.Sprintf("/%s-%d", slug, i)
+			}
+		}
+	}
+
+	for {
+		candidate, err := RandomPath(randomPathLength)
+		if err != nil {
+			return "", err
+		}
+		if !taken(candidate) {
+			return candidate, nil
+		}
+	}
+}
+
+// slugOf returns a path segment derived from the title of redirect,
+// or else from the last segment of the path of its URL or its host
+func slugOf(redirect Redirect) string {
+	text := redirect.Title
+	if text == "" {
+		if u, err := url.Parse(redirect.URL); err == nil {
+			text = strings.TrimSuffix(path.Base(u.Path), path.Ext(u.Path))
+			if text == "" || text == "/" || text == "." {
+				text = strings.TrimPrefix(u.Hostname(), "www.")
+			}
+		}
+	}
+
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(text) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+			continue
+		}
+		dash = true
+	}
+
+	slug := []rune(b.String())
+	if len(slug) > maxSlugLength {
+		// cut at the last word fitting
+		slug = slug[:maxSlugLength]
+		for i := len(slug) - 1; i > 0; i-- {
+			if slug[i] == '-' {
+				slug = slug[:i]
+				break
+			}
+		}
+	}
+
+	return string(slug)
+}
+
+// ParseBookmarks returns the links in a bookmarks file exported by a
+// browser, in the Netscape bookmark format, with their titles. Their
+// paths are empty, the anchors not leading to web pages are skipped.
+func ParseBookmarks(r io.Reader) ([]Redirect, error) {
+	anchors, err := linkextract.Links(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var redirects []Redirect
+	for _, anchor := range anchors {
+		u, err := url.Parse(anchor.Href)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			continue
+		}
+
+		redirects = append(redirects, Redirect{URL: anchor.Href, Title: anchor.Text})
+	}
+
+	return redirects, nil
+}
+
+// ParseLinksCSV returns the links in a CSV file, whose columns are
+// named by a header line with "url" and optionally "path" and
+// "title". Without a header, the columns are the URL alone, the path
+// and the URL, or the path, the URL and the title. The paths may be
+// empty.
+func ParseLinksCSV(r io.Reader) ([]Redirect, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	columns := map[string]int{"path": -1, "url": -1, "title": -1}
+	header := false
+	for i, name := range records[0] {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if _, ok := columns[name]; ok {
+			columns[name] = i
+			header = header || name == "url"
+		}
+	}
+
+	if header {
+		records = records[1:]
+	} else {
+		columns = map[string]int{"path": -1, "url": 0, "title": -1}
+		if n := len(records[0]); n >= 2 {
+			columns = map[string]int{"path": 0, "url": 1, "title": -1}
+			if n >= 3 {
+				columns["title"] = 2
+			}
+		}
+	}
+
+	field := func(record []string, column string) string {
+		if i := columns[column]; i >= 0 && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	redirects := make([]Redirect, 0, len(records))
+	for _, record := range records {
+		redirects = append(redirects, Redirect{
+			Path:  field(record, "path"),
+			URL:   field(record, "url"),
+			Title: field(record, "title"),
+		})
+	}
+
+	return redirects, nil
+}
@@ -0,0 +1,227 @@
+package urlshort
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPlanImport(t *testing.T) {
+	existing := []Redirect{
+		{Path: "/docs", URL: "https://example.com/docs"},
+		{Path: "/blog", URL: "https://example.com/blog"},
+	}
+	links := []Redirect{
+		{Path: "docs", URL: "https://example.com/docs"},
+		{Path: "/blog", URL: "https://example.com/news"},
+		{URL: "https://example.com/blog"},
+		{URL: "https://example.com/release", Title: "Release Notes!"},
+		{URL: "https://example.com/2024/release.html"},
+		{URL: "https://www.example.org/"},
+		{Path: "/new", URL: "https://example.com/new"},
+		{Path: "/new", URL: "https://example.com/other"},
+		{Path: "/bad", URL: "relative"},
+	}
+
+	results, err := PlanImport(existing, links, ImportOptions{Paths: "slug"})
+	if err != nil {
+		t.Fatalf("PlanImport failed with error %v\n", err)
+	}
+
+	expected := []struct {
+		action, path, existing string
+	}{
+		{ImportDuplicate, "/docs", "/docs"},
+		{ImportConflict, "/blog", "/blog"},
+		{ImportDuplicate, "", "/blog"},
+		{ImportCreate, "/release-notes", ""},
+		{ImportCreate, "/release", ""},
+		{ImportCreate, "/example-org", ""},
+		{ImportCreate, "/new", ""},
+		{ImportConflict, "/new", "/new"},
+		{ImportInvalid, "/bad", ""},
+	}
+	if len(results) != len(expected) {
+		t.Fatalf("Expected %d results, got %d\n", len(expected), len(results))
+	}
+	for i, result := range results {
+		if result.Action != expected[i].action || result.Redirect.Path != expected[i].path || result.Existing != expected[i].existing {
+			t.Errorf("Expected %+v for link %d, got %s %s %s\n", expected[i], i, result.Action, result.Redirect.Path, result.Existing)
+		}
+	}
+
+	// overwriting replaces the existing links once
+	results, err = PlanImport(existing, links[:2], ImportOptions{Overwrite: true})
+	if err != nil {
+		t.Fatalf("PlanImport failed with error %v\n", err)
+	}
+	if results[0].Action != ImportDuplicate || results[1].Action != ImportReplace {
+		t.Errorf("Expected a duplicate and a replacement, got %v\n", results)
+	}
+
+	// the slugs taken get a suffix, random paths are used without title
+	results, err = PlanImport(existing, []Redirect{
+		{URL: "https://example.com/a", Title: "Docs"},
+		{URL: "https://example.com/b", Title: "Docs"},
+		{URL: "https://example.com/c"},
+	}, ImportOptions{})
+	if err != nil {
+		t.Fatalf("PlanImport failed with error %v\n", err)
+	}
+	if results[0].Redirect.Path == "/docs" || results[0].Redirect.Path == results[1].Redirect.Path {
+		t.Errorf("Expected distinct random paths, got %v\n", results)
+	}
+	results, err = PlanImport(existing, []Redirect{
+		{URL: "https://example.com/a", Title: "Docs"},
+		{URL: "https://example.com/b", Title: "Docs"},
+	}, ImportOptions{Paths: "slug"})
+	if err != nil {
+		t.Fatalf("PlanImport failed with error %v\n", err)
+	}
+	if results[0].Redirect.Path != "/docs-2" || results[1].Redirect.Path != "/docs-3" {
+		t.Errorf("Expected /docs-2 and /docs-3, got %v\n", results)
+	}
+
+	if _, err := PlanImport(existing, links, ImportOptions{Paths: "words"}); err == nil {
+		t.Errorf("Expected an error for unknown paths\n")
+	}
+}
+
+func TestPlanImportChanges(t *testing.T) {
+	split := func(urls ...string) []Target {
+		var targets []Target
+		for _, u := range urls {
+			targets = append(targets, Target{URL: u})
+		}
+		return targets
+	}
+
+	existing := []Redirect{
+		{Path: "/ab", Targets: split("https://example.com/a", "https://example.com/b")},
+		{Path: "/docs", URL: "https://example.com/docs", Status: 302},
+	}
+	links := []Redirect{
+		{Path: "/ab", Targets: split("https://example.com/a", "https://example.com/c")},
+		{Path: "/ab", Targets: split("https://example.com/a", "https://example.com/b")},
+		{Path: "/docs", URL: "https://example.com/docs", Params: map[string]string{}},
+		{Path: "/docs", URL: "https://example.com/docs", Status: 301},
+	}
+
+	for _, test := range []struct {
+		overwrite bool
+		actions   []string
+	}{
+		{false, []string{ImportConflict, ImportDuplicate, ImportDuplicate, ImportConflict}},
+		{true, []string{ImportReplace, ImportDuplicate, ImportDuplicate, ImportReplace}},
+	} {
+		// each link is compared with the existing ones, one at a time
+		for i, link := range links {
+			results, err := PlanImport(existing, []Redirect{link}, ImportOptions{Overwrite: test.overwrite})
+			if err != nil {
+				t.Fatalf("PlanImport failed with error %v\n", err)
+			}
+			if results[0].Action != test.actions[i] {
+				t.Errorf("Expected %s for link %d with overwrite %v, got %s\n", test.actions[i], i, test.overwrite, results[0].Action)
+			}
+		}
+	}
+}
+
+func TestPlanImportNormalized(t *testing.T) {
+	existing := []Redirect{
+		{Path: "/docs", URL: "https://example.com/docs"},
+		{Path: "/gh/:user", URL: "https://github.com/:user"},
+	}
+	links := []Redirect{
+		{Path: "/Docs/", URL: "https://example.com/docs"},
+		{Path: "/DOCS", URL: "https://example.com/new-docs"},
+		{Path: "/gh/:owner", URL: "https://github.com/:owner"},
+		{URL: "https://example.com/x", Title: "Docs"},
+	}
+	n := Normalization{FoldCase: true, TrailingSlash: true}
+
+	for _, test := range []struct {
+		overwrite bool
+		actions   []string
+	}{
+		{false, []string{ImportDuplicate, ImportConflict, ImportConflict, ImportCreate}},
+		{true, []string{ImportDuplicate, ImportReplace, ImportConflict, ImportCreate}},
+	} {
+		results, err := PlanImport(existing, links, ImportOptions{Paths: "slug", Overwrite: test.overwrite, Normalization: n})
+		if err != nil {
+			t.Fatalf("PlanImport failed with error %v\n", err)
+		}
+		for i, result := range results {
+			if result.Action != test.actions[i] {
+				t.Errorf("Expected %s for link %d with overwrite %v, got %s\n", test.actions[i], i, test.overwrite, result.Action)
+			}
+		}
+		if results[3].Redirect.Path != "/docs-2" {
+			t.Errorf("Expected the slug /docs-2, got %s\n", results[3].Redirect.Path)
+		}
+	}
+}
+
+func TestParseBookmarks(t *testing.T) {
+	bookmarks := `<!DOCTYPE NETSCAPE-Bookmark-file-1>
+<META HTTP-EQUIV="Content-Type" CONTENT="text/html; charset=UTF-8">
+<TITLE>Bookmarks</TITLE>
+<H1>Bookmarks</H1>
+<DL><p>
+    <DT><H3>Work</H3>
+    <DL><p>
+        <DT><A HREF="https://example.com/wiki" ADD_DATE="1700000000">Team Wiki</A>
+        <DT><A HREF="javascript:alert(1)">Bookmarklet</A>
+    </DL><p>
+    <DT><A HREF="http://example.org/">Example</A>
+</DL><p>
+`
+
+	redirects, err := ParseBookmarks(strings.NewReader(bookmarks))
+	if err != nil {
+		t.Fatalf("ParseBookmarks failed with error %v\n", err)
+	}
+
+	expected := []Redirect{
+		{URL: "https://example.com/wiki", Title: "Team Wiki"},
+		{URL: "http://example.org/", Title: "Example"},
+	}
+	if !reflect.DeepEqual(redirects, expected) {
+		t.Errorf("Expected %v, got %v\n", expected, redirects)
+	}
+}
+
+func TestParseLinksCSV(t *testing.T) {
+	for _, test := range []struct {
+		csv      string
+		expected []Redirect
+	}{
+		{
+			"title,url,path\nDocs,https://example.com/docs,/docs\n\"Blog, news\",https://example.com/blog,\n",
+			[]Redirect{
+				{Path: "/docs", URL: "https://example.com/docs", Title: "Docs"},
+				{URL: "https://example.com/blog", Title: "Blog, news"},
+			},
+		},
+		{
+			"https://example.com/a\nhttps://example.com/b\n",
+			[]Redirect{{URL: "https://example.com/a"}, {URL: "https://example.com/b"}},
+		},
+		{
+			"/a, https://example.com/a, A\n/b, https://example.com/b\n",
+			[]Redirect{
+				{Path: "/a", URL: "https://example.com/a", Title: "A"},
+				{Path: "/b", URL: "https://example.com/b"},
+			},
+		},
+	} {
+		redirects, err := ParseLinksCSV(strings.NewReader(test.csv))
+		if err != nil {
+			t.Errorf("ParseLinksCSV failed with error %v for %q\n", err, test.csv)
+			continue
+		}
+		if !reflect.DeepEqual(redirects, test.expected) {
+			t.Errorf("Expected %v for %q, got %v\n", test.expected, test.csv, redirects)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package urlshort
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+const maxChainLength = 10
+
+// Chains describes the hosts served by the shortener itself, so
+// that the redirects whose target is another short link on one of
+// them can be detected: a redirect table where following such
+// targets leads back to a path already visited is rejected, and
+// the chains can be collapsed to their final destination.
+type Chains struct {
+	// Hosts are the host names of the short links, like
+	// "go.example.com", their ports are ignored
+	Hosts []string
+
+	// Collapse replaces the target of the redirects leading to
+	// another short link with the final destination of the chain
+	Collapse bool
+}
+
+// ChainError is returned when a redirect table
+// contains a loop, or a chain too long to follow
+type ChainError struct {
+	Chain []string // the paths followed
+	Loop  bool
+}
+
+func (e *ChainError) Error() string {
+	if e.Loop {
+		return "redirect loop: " + strings.Join(e.Chain, " -> ")
+	}
+	return fmt.Sprintf("redirect chain longer than %d links: %s", maxChainLength, strings.Join(e.Chain, " -> "))
+}
+
+// ResolveChains makes the handlers built from redirect data check
+// the chains of redirects as described by c when loading them.
+func ResolveChains(c Chains) Option {
+	return func(o *options) {
+		o.chains = c
+	}
+}
+
+// Resolve follows the target of each redirect through the short
+// links in redirects, returning a *ChainError if it finds a loop
+// or a chain too long. The redirects are returned with their
+// targets collapsed to the final destination if c.Collapse is true.
+// The URLs of the rules of the redirects are followed and collapsed
+// too. The redirects with parameters or wildcards are not followed,
+// since their targets are only templates, and neither are the ones
+// splitting their visitors among several targets.
+func (c Chains) Resolve(redirects []Redirect) ([]Redirect, error) {
+	return c.resolve(redirects, Normalization{})
+}
+
+// resolve is like Resolve, for redirects whose paths have
+// been normalized as described by n
+func (c Chains) resolve(redirects []Redirect, n Normalization) ([]Redirect, error) {
+	if len(c.Hosts) == 0 {
+		return redirects, nil
+	}
+
+	rt, err := newRouter(redirects)
+	if err != nil {
+		return nil, err
+	}
+	rt.foldCase = n.FoldCase
+
+	resolved := make([]Redirect, len(redirects))
+	for i, redirect := range redirects {
+		resolved[i] = redirect
+		if strings.Contains(redirect.Path, "/:") || strings.HasSuffix(redirect.Path, "/*") || len(redirect.Targets) > 0 {
+			continue
+		}
+
+		if len(redirect.Rules) > 0 && c.Collapse {
+			resolved[i].Rules = append([]Rule(nil), redirect.Rules...)
+		}
+		for j, rule := range redirect.Rules {
+			final, err := c.follow(rt, n, []string{redirect.Path}, rule.URL)
+			if err != nil {
+				return nil, err
+			}
+			if c.Collapse {
+				resolved[i].Rules[j].URL = final
+			}
+		}
+
+		final, err := c.follow(rt, n, []string{redirect.Path}, redirect.URL)
+		if err != nil {
+			return nil, err
+		}
+		if c.Collapse {
+			resolved[i].URL = final
+		}
+	}
+
+	return resolved, nil
+}
+
+// follow returns the final destination of target, reached through
+// the paths of chain, as far as it can be collapsed: the links
+// checking something before redirecting, or not always redirecting
+// to their URL, are kept as the destination. The URLs of the rules
+// of the links on the way are followed too, for loops.
+func (c Chains) follow(rt *router, n Normalization, chain []string, target string) (string, error) {
+	path, ok := c.localPath(target)
+	if !ok {
+		return target, nil
+	}
+
+	next, ok := rt.lookup(n.clean(path))
+	if !ok {
+		// a short link served by someone else
+		return target, nil
+	}
+	if len(next.Targets) > 0 {
+		// it has no single destination
+		return target, nil
+	}
+
+	// not appending to chain in place, it's shared by the rules
+	chain = append(chain[:len(chain):len(chain)], next.Path)
+	for _, visited := range chain[:len(chain)-1] {
+		if visited == next.Path {
+			return "", &ChainError{Chain: chain, Loop: true}
+		}
+	}
+	if len(chain) > maxChainLength {
+		return "", &ChainError{Chain: chain}
+	}
+
+	for _, rule := range next.Rules {
+		if _, err := c.follow(rt, n, chain, rule.URL); err != nil {
+			return "", err
+		}
+	}
+
+	final, err := c.follow(rt, n, chain, next.URL)
+	if err != nil {
+		return "", err
+	}
+	if !next.collapsible() {
+		return target, nil
+	}
+	return final, nil
+}
+
+// collapsible reports if the requests to rd are always redirected
+// to its URL, without any check, so that the links leading to rd
+// can lead to its URL directly
+func (rd Redirect) collapsible() bool {
+	return rd.Password == "" && !rd.OneTime && rd.MaxClicks == 0 && rd.Expires == nil &&
+		!rd.Disabled && !rd.Preview && len(rd.Rules) == 0 && len(rd.Targets) == 0
+}
+
+// localPath returns the path of target if it's on one of c.Hosts,
+// regardless of the port
+func (c Chains) localPath(target string) (string, bool) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return "", false
+	}
+
+	for _, host := range c.Hosts {
+		if NormalizeHost(u.Host) == NormalizeHost(host) {
+			if u.Path == "" {
+				return "/", true
+			}
+			return u.Path, true
+		}
+	}
+
+	return "", false
+}
+
+// ChainGuard returns a WritableStore storing the redirects in store
+// only if they don't create a loop, as described by c, returning a
+// *ChainError otherwise. If c.Collapse is true the redirects leading
+// to another short link are stored with the final destination.
+// The chains are followed through the redirects returned by list,
+// like the ones of store along with the ones served next to it, or
+// through the ones of store if list is nil, with their paths
+// normalized as described by n, as the requests would be.
+func ChainGuard(store WritableStore, c Chains, n Normalization, list func() ([]Redirect, error)) WritableStore {
+	if list == nil {
+		list = store.List
+	}
+	return &chainGuard{WritableStore: store, chains: c, normalization: n, list: list}
+}
+
+type chainGuard struct {
+	WritableStore
+	chains        Chains
+	normalization Normalization
+	list          func() ([]Redirect, error)
+}
+
+func (g *chainGuard) Put(redirect Redirect) error {
+	redirects, err := g.list()
+	if err != nil {
+		return err
+	}
+
+	// the new redirect first, so its index is known,
+	// replacing the ones matching the same requests
+	key := g.normalization.Key(redirect.Path)
+	table := []Redirect{redirect}
+	for _, r := range redirects {
+		if g.normalization.Key(r.Path) != key {
+			table = append(table, r)
+		}
+	}
+
+	if table, err = g.normalization.redirects(table); err != nil {
+		return err
+	}
+	resolved, err := g.chains.resolve(table, g.normalization)
+	if err != nil {
+		return err
+	}
+
+	resolved[0].Path = redirect.Path
+	return g.WritableStore.Put(resolved[0])
+}
@@ -0,0 +1,215 @@
+package urlshort
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResolveChains(t *testing.T) {
+	redirects := []Redirect{
+		{Path: "/a", URL: "https://go.example.com/b"},
+		{Path: "/b", URL: "http://go.example.com:8080/c?x=1"},
+		{Path: "/c", URL: "https://example.com/final"},
+		{Path: "/d", URL: "https://go.example.com/unknown"},
+		{Path: "/gh/:user", URL: "https://go.example.com/gh/:user"},
+	}
+
+	resolved, err := Chains{Hosts: []string{"go.example.com"}}.Resolve(redirects)
+	if err != nil {
+		t.Fatalf("Resolve failed with error %v\n", err)
+	}
+	if resolved[0].URL != redirects[0].URL {
+		t.Errorf("Expected the chains to be kept, got %v\n", resolved[0].URL)
+	}
+
+	resolved, err = Chains{Hosts: []string{"go.example.com"}, Collapse: true}.Resolve(redirects)
+	if err != nil {
+		t.Fatalf("Resolve failed with error %v\n", err)
+	}
+	for i, expected := range []string{
+		"https://example.com/final",
+		"https://example.com/final",
+		"https://example.com/final",
+		"https://go.example.com/unknown",
+		"https://go.example.com/gh/:user",
+	} {
+		if resolved[i].URL != expected {
+			t.Errorf("Expected %s to lead to %s, got %s\n", resolved[i].Path, expected, resolved[i].URL)
+		}
+	}
+}
+
+func TestResolveChainsChecks(t *testing.T) {
+	expires := time.Now().Add(time.Hour)
+	for _, secret := range []Redirect{
+		{Password: "$2a$10$hash"},
+		{OneTime: true},
+		{MaxClicks: 3},
+		{Expires: &expires},
+		{Disabled: true},
+		{Preview: true},
+		{Rules: []Rule{{Devices: []string{"ios"}, URL: "https://apps.example.com/"}}},
+	} {
+		secret.Path, secret.URL = "/secret", "https://private.example.com/"
+		redirects := []Redirect{{Path: "/a", URL: "https://go.example.com/secret"}, secret}
+
+		resolved, err := Chains{Hosts: []string{"go.example.com"}, Collapse: true}.Resolve(redirects)
+		if err != nil {
+			t.Fatalf("Resolve failed with error %v\n", err)
+		}
+		if resolved[0].URL != redirects[0].URL {
+			t.Errorf("Expected /a not to be collapsed through %+v, got %s\n", secret, resolved[0].URL)
+		}
+
+		// the loops through them are still detected
+		secret.URL = "https://go.example.com/a"
+		if _, err := (Chains{Hosts: []string{"go.example.com"}}).Resolve([]Redirect{redirects[0], secret}); err == nil {
+			t.Errorf("Expected a loop through %+v\n", secret)
+		}
+	}
+}
+
+func TestResolveChainsRules(t *testing.T) {
+	ios := func(url string) []Rule {
+		return []Rule{{Devices: []string{"ios"}, URL: url}}
+	}
+	chains := Chains{Hosts: []string{"go.example.com"}, Collapse: true}
+
+	redirects := []Redirect{
+		{Path: "/a", URL: "https://example.com/a", Rules: ios("https://go.example.com/b")},
+		{Path: "/b", URL: "https://example.com/b"},
+	}
+	resolved, err := chains.Resolve(redirects)
+	if err != nil {
+		t.Fatalf("Resolve failed with error %v\n", err)
+	}
+	if resolved[0].Rules[0].URL != "https://example.com/b" {
+		t.Errorf("Expected the rule of /a to be collapsed, got %s\n", resolved[0].Rules[0].URL)
+	}
+	if redirects[0].Rules[0].URL != "https://go.example.com/b" {
+		t.Errorf("Expected the rules given to be left alone, got %s\n", redirects[0].Rules[0].URL)
+	}
+
+	for _, redirects := range [][]Redirect{
+		{
+			{Path: "/a", URL: "https://example.com/a", Rules: ios("https://go.example.com/b")},
+			{Path: "/b", URL: "https://go.example.com/a"},
+		},
+		{
+			{Path: "/a", URL: "https://go.example.com/b"},
+			{Path: "/b", URL: "https://example.com/b", Rules: ios("https://go.example.com/a")},
+		},
+	} {
+		_, err := chains.Resolve(redirects)
+		if chainErr, ok := err.(*ChainError); !ok || !chainErr.Loop {
+			t.Errorf("Expected a loop through the rules of %v, got %v\n", redirects, err)
+		}
+	}
+}
+
+func TestRedirectLoop(t *testing.T) {
+	data := []byte(`[
+		{"path": "/a", "url": "https://go.example.com/b"},
+		{"path": "/b", "url": "https://go.example.com/c"},
+		{"path": "/c", "url": "https://GO.example.com/a"}
+	]`)
+
+	_, err := DataHandler(data, "json", http.NotFoundHandler(), ResolveChains(Chains{Hosts: []string{"go.example.com"}}))
+	chainErr, ok := err.(*ChainError)
+	if !ok || !chainErr.Loop || !strings.Contains(err.Error(), "/a -> /b -> /c -> /a") {
+		t.Errorf("Expected a redirect loop error, got %v\n", err)
+	}
+
+	// without local hosts the targets are not followed
+	if _, err := DataHandler(data, "json", http.NotFoundHandler()); err != nil {
+		t.Errorf("DataHandler failed with error %v\n", err)
+	}
+}
+
+func TestChainGuard(t *testing.T) {
+	store := ChainGuard(newMemoryStore(Redirect{Path: "/a", URL: "https://go.example.com/b"}),
+		Chains{Hosts: []string{"go.example.com"}, Collapse: true}, Normalization{}, nil)
+
+	err := store.Put(Redirect{Path: "/b", URL: "https://go.example.com/a"})
+	if _, ok := err.(*ChainError); !ok {
+		t.Errorf("Expected a ChainError creating a loop, got %v\n", err)
+	}
+
+	if err := store.Put(Redirect{Path: "/c", URL: "https://go.example.com/a"}); err != nil {
+		t.Fatalf("Put failed with error %v\n", err)
+	}
+	if redirect, _ := store.Get("/c"); redirect.URL != "https://go.example.com/b" {
+		t.Errorf("Expected /c to be collapsed to the target of /a, got %v\n", redirect.URL)
+	}
+}
+
+func TestChainGuardList(t *testing.T) {
+	// the links of the files served next to the store
+	files := []Redirect{
+		{Path: "/docs", URL: "https://go.example.com/Intro"},
+		{Path: "/shadowed", URL: "https://go.example.com/x"},
+	}
+	store := newMemoryStore(Redirect{Path: "/shadowed", URL: "https://example.com/shadowed"})
+	list := func() ([]Redirect, error) {
+		redirects, _ := store.List()
+		for _, redirect := range files {
+			if _, ok := store[redirect.Path]; !ok {
+				redirects = append(redirects, redirect)
+			}
+		}
+		return redirects, nil
+	}
+	guard := ChainGuard(store, Chains{Hosts: []string{"go.example.com"}}, Normalization{FoldCase: true}, list)
+
+	// /Intro leads back to /docs once normalized
+	err := guard.Put(Redirect{Path: "/intro", URL: "https://go.example.com/DOCS"})
+	if _, ok := err.(*ChainError); !ok {
+		t.Errorf("Expected a ChainError creating a loop through a file link, got %v\n", err)
+	}
+
+	// the file link shadowed by the stored one is not followed
+	if err := guard.Put(Redirect{Path: "/x", URL: "https://go.example.com/shadowed"}); err != nil {
+		t.Errorf("Put failed with error %v\n", err)
+	}
+}
+
+// memoryStore is a WritableStore keeping the redirects in a map
+type memoryStore map[string]Redirect
+
+func newMemoryStore(redirects ...Redirect) memoryStore {
+	s := make(memoryStore)
+	for _, redirect := range redirects {
+		s[redirect.Path] = redirect
+	}
+	return s
+}
+
+func (s memoryStore) Get(path string) (Redirect, error) {
+	if redirect, ok := s[path]; ok {
+		return redirect, nil
+	}
+	return Redirect{}, ErrNotFound
+}
+
+func (s memoryStore) List() ([]Redirect, error) {
+	var redirects []Redirect
+	for _, redirect := range s {
+		redirects = append(redirects, redirect)
+	}
+	return redirects, nil
+}
+
+func (s memoryStore) Put(redirect Redirect) error {
+	s[redirect.Path] = redirect
+	return nil
+}
+
+func (s memoryStore) Delete(path string) error {
+	if _, ok := s[path]; !ok {
+		return ErrNotFound
+	}
+	delete(s, path)
+	return nil
+}
@@ -0,0 +1,252 @@
+package urlshort
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CheckResult is the outcome of the check of the target of a
+// redirect, or of one of its targets or rules, named by Variant
+type CheckResult struct {
+	Path    string    `json:"path"`
+	Variant string    `json:"variant,omitempty"`
+	URL     string    `json:"url"`
+	Status  int       `json:"status,omitempty"`
+	Error   string    `json:"error,omitempty"`
+	Broken  bool      `json:"broken"`
+	Checked time.Time `json:"checked"`
+}
+
+// errRedirectLoop is returned when the target of
+// a redirect leads back to an URL already visited
+var errRedirectLoop = errors.New("redirect loop")
+
+const maxCheckRedirects = 10
+
+// Checker checks that the targets of the redirects are still
+// reachable, requesting them with HEAD (or GET if the server doesn't
+// support HEAD) and following their redirects. A target is broken
+// if it can't be reached, answers with a 4xx or 5xx status or its
+// redirects loop.
+//
+// The results of the last check of each path are kept, and served
+// as a JSON report by ServeHTTP.
+type Checker struct {
+	client      *http.Client
+	concurrency int
+
+	mu      sync.Mutex
+	results map[string]CheckResult
+}
+
+// NewChecker returns a Checker giving up on the targets that don't
+// answer within timeout, checking up to concurrency of them at once.
+func NewChecker(timeout time.Duration, concurrency int) *Checker {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	return &Checker{
+		client: &http.Client{
+			Timeout: timeout,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) >= maxCheckRedirects {
+					return fmt.Errorf("stopped after %d redirects", maxCheckRedirects)
+				}
+				for _, prev := range via {
+					if prev.URL.String() == req.URL.String() {
+						return errRedirectLoop
+					}
+				}
+				return nil
+			},
+		},
+		concurrency: concurrency,
+		results:     make(map[string]CheckResult),
+	}
+}
+
+// Check checks the target of each redirect, each of its targets and
+// the ones of its rules, returning the results ordered by path. The
+// redirects whose URL has placeholders, being only templates of the
+// actual targets, are skipped.
+func (c *Checker) Check(redirects []Redirect) []CheckResult {
+	var checked []Redirect
+	var variants []string
+	for _, redirect := range redirects {
+		if strings.Contains(redirect.Path, "/:") || strings.HasSuffix(redirect.Path, "/*") {
+			continue
+		}
+
+		if len(redirect.Targets) == 0 {
+			checked = append(checked, redirect)
+			variants = append(variants, "")
+		}
+		for i, t := range redirect.Targets {
+			checked = append(checked, Redirect{Path: redirect.Path, URL: t.URL})
+			variants = append(variants, t.name(i))
+		}
+		for i, rule := range redirect.Rules {
+			checked = append(checked, Redirect{Path: redirect.Path, URL: rule.URL})
+			variants = append(variants, "rule "+strconv.Itoa(i+1))
+		}
+	}
+
+	results := make([]CheckResult, len(checked))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for i := 0; i < c.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				results[j] = c.check(checked[j])
+				results[j].Variant = variants[j]
+			}
+		}()
+	}
+
+	for j := range checked {
+		jobs <- j
+	}
+	close(jobs)
+	wg.Wait()
+
+	sortResults(results)
+
+	c.mu.Lock()
+	c.results = make(map[string]CheckResult, len(results))
+	for _, result := range results {
+		c.results[variantKey(result.Path, result.Variant)] = result
+	}
+	c.mu.Unlock()
+
+	return results
+}
+
+// check requests the target of redirect
+func (c *Checker) check(redirect Redirect) CheckResult {
+	result := CheckResult{
+		Path:    redirect.Path,
+		URL:     redirect.URL,
+		Checked: now(),
+	}
+
+	resp, err := c.request(http.MethodHead, redirect.URL)
+	if err == nil && (resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented) {
+		resp, err = c.request(http.MethodGet, redirect.URL)
+	}
+
+	if err != nil {
+		result.Error = err.Error()
+		if errors.Is(err, errRedirectLoop) {
+			result.Error = errRedirectLoop.Error()
+		}
+		result.Broken = true
+		return result
+	}
+
+	result.Status = resp.StatusCode
+	result.Broken = resp.StatusCode >= 400
+
+	return result
+}
+
+func (c *Checker) request(method, url string) (*http.Response, error) {
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "urlshort-checker")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	return resp, nil
+}
+
+// Run checks the redirects returned by list every interval, until
+// stop is closed. The errors returned by list are passed to onError,
+// if not nil, and the broken targets to onBroken, if not nil.
+func (c *Checker) Run(interval time.Duration, list func() ([]Redirect, error), stop <-chan struct{}, onError func(error), onBroken func(CheckResult)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		redirects, err := list()
+		if err != nil && onError != nil {
+			onError(err)
+		}
+
+		if err == nil {
+			for _, result := range c.Check(redirects) {
+				if result.Broken && onBroken != nil {
+					onBroken(result)
+				}
+			}
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Results returns the results of the last check, ordered by path
+func (c *Checker) Results() []CheckResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	results := make([]CheckResult, 0, len(c.results))
+	for _, result := range c.results {
+		results = append(results, result)
+	}
+
+	sortResults(results)
+
+	return results
+}
+
+// sortResults orders results by path, then by variant
+func sortResults(results []CheckResult) {
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Path != results[j].Path {
+			return results[i].Path < results[j].Path
+		}
+		return results[i].Variant < results[j].Variant
+	})
+}
+
+// ServeHTTP serves the results of the last check as a JSON array,
+// only the broken targets if the broken query parameter is set
+func (c *Checker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	results := c.Results()
+
+	if r.URL.Query().Get("broken") != "" {
+		broken := []CheckResult{}
+		for _, result := range results {
+			if result.Broken {
+				broken = append(broken, result)
+			}
+		}
+		results = broken
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	enc.Encode(results)
+}
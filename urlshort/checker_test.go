@@ -0,0 +1,80 @@
+package urlshort
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestChecker(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("/moved", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/ok", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/loop", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop2", http.StatusFound)
+	})
+	mux.HandleFunc("/loop2", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop", http.StatusFound)
+	})
+	mux.HandleFunc("/get-only", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/error", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	target := httptest.NewServer(mux)
+	defer target.Close()
+
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	c := NewChecker(time.Second, 2)
+	results := c.Check([]Redirect{
+		{Path: "/a", URL: target.URL + "/ok"},
+		{Path: "/b", URL: target.URL + "/moved"},
+		{Path: "/c", URL: target.URL + "/loop"},
+		{Path: "/d", URL: target.URL + "/get-only"},
+		{Path: "/e", URL: target.URL + "/missing"},
+		{Path: "/f", URL: target.URL + "/error"},
+		{Path: "/g", URL: down.URL},
+		{Path: "/gh/:user", URL: "https://github.com/:user"},
+	})
+
+	expected := []CheckResult{
+		{Path: "/a", Status: 200},
+		{Path: "/b", Status: 200},
+		{Path: "/c", Broken: true, Error: "redirect loop"},
+		{Path: "/d", Status: 200},
+		{Path: "/e", Status: 404, Broken: true},
+		{Path: "/f", Status: 500, Broken: true},
+		{Path: "/g", Broken: true},
+	}
+	if len(results) != len(expected) {
+		t.Fatalf("Expected %d results, got %+v\n", len(expected), results)
+	}
+
+	for i, result := range results {
+		e := expected[i]
+		if result.Path != e.Path || result.Status != e.Status || result.Broken != e.Broken ||
+			(e.Error != "" && result.Error != e.Error) || (result.Broken && result.Status == 0 && result.Error == "") {
+			t.Errorf("Expected %+v, got %+v\n", e, result)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	c.ServeHTTP(rec, httptest.NewRequest("GET", "/checks?broken=1", nil))
+
+	var report []CheckResult
+	if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+		t.Fatalf("Cannot decode report: %v\n", err)
+	}
+	if len(report) != 4 || report[0].Path != "/c" {
+		t.Errorf("Expected the 4 broken links in the report, got %+v\n", report)
+	}
+}
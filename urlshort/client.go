@@ -0,0 +1,155 @@
+package urlshort
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// APIClient is a WritableStore, a Counter and a History managing
+// the redirects of a running server through its admin API,
+// served by AdminHandler.
+type APIClient struct {
+	baseURL string
+	token   string
+	actor   string
+	client  *http.Client
+}
+
+// NewAPIClient returns an APIClient for the admin API at baseURL,
+// like "http://localhost:8081", authenticated with token if not empty.
+func NewAPIClient(baseURL, token string) *APIClient {
+	return &APIClient{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		token:   token,
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// As returns a copy of c sending actor as the author of the
+// changes, recorded by the server as claimed, since it can't
+// verify it: their actor is the owner of the token
+func (c *APIClient) As(actor string) *APIClient {
+	clone := *c
+	clone.actor = actor
+	return &clone
+}
+
+// Get returns the redirect for path
+func (c *APIClient) Get(path string) (Redirect, error) {
+	link, err := c.Link(path)
+	return link.Redirect, err
+}
+
+// Link returns the redirect for path along with its clicks
+func (c *APIClient) Link(path string) (Link, error) {
+	var link Link
+	err := c.do(http.MethodGet, "/links"+escapePath(path), nil, &link)
+	return link, err
+}
+
+// List returns all the redirects, ordered by path
+func (c *APIClient) List() ([]Redirect, error) {
+	links, err := c.Links()
+	if err != nil {
+		return nil, err
+	}
+
+	redirects := make([]Redirect, len(links))
+	for i, link := range links {
+		redirects[i] = link.Redirect
+	}
+
+	return redirects, nil
+}
+
+// Links returns all the redirects along with their clicks
+func (c *APIClient) Links() ([]Link, error) {
+	var links []Link
+	err := c.do(http.MethodGet, "/links", nil, &links)
+	return links, err
+}
+
+// Put creates or replaces redirect
+func (c *APIClient) Put(redirect Redirect) error {
+	body, err := json.Marshal(redirect)
+	if err != nil {
+		return err
+	}
+
+	return c.do(http.MethodPut, "/links"+escapePath(redirect.Path), body, nil)
+}
+
+// Delete removes the redirect for path
+func (c *APIClient) Delete(path string) error {
+	return c.do(http.MethodDelete, "/links"+escapePath(path), nil, nil)
+}
+
+// History returns the changes of the link for path, oldest first
+func (c *APIClient) History(path string) ([]Change, error) {
+	var changes []Change
+	err := c.do(http.MethodGet, "/history"+escapePath(path), nil, &changes)
+	return changes, err
+}
+
+// Incr is not supported by the admin API,
+// the clicks are counted only by the server
+func (c *APIClient) Incr(path string) (int64, error) {
+	return 0, fmt.Errorf("cannot count clicks through the admin API")
+}
+
+// Count returns the clicks of path
+func (c *APIClient) Count(path string) (int64, error) {
+	link, err := c.Link(path)
+	return link.Clicks, err
+}
+
+// do sends a request to the API, decoding
+// the JSON response into v if not nil
+func (c *APIClient) do(method, path string, body []byte, v interface{}) error {
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequest(method, c.baseURL+path, r)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	if c.actor != "" {
+		req.Header.Set("X-Actor", c.actor)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case resp.StatusCode == http.StatusServiceUnavailable:
+		return ErrUnavailable
+	case resp.StatusCode >= 300:
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s %s: %s", method, path, strings.TrimSpace(string(msg)))
+	}
+
+	if v == nil {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,552 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"gophercises/urlshort"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+func add(s *store, args []string) error {
+	fs := newFlagSet("add [flags] <path> <url>")
+	status := fs.Int("status", 0, "status code of the redirect (301, 302, 307 or 308, 302 if omitted)")
+	title := fs.String("title", "", "title shown on the preview page")
+	preview := fs.Bool("preview", false, "show a preview page instead of redirecting")
+	preserveQuery := fs.Bool("preserve-query", false, "append the query string of the requests to the URL")
+	expires := fs.String("expires", "", "expiration of the link, as a RFC 3339 time or a duration from now")
+	password := fs.String("password", "", "password the visitors have to enter before being redirected")
+	maxClicks := fs.Int("max-clicks", 0, "number of redirects after which the link is disabled (0 for unlimited)")
+	oneTime := fs.Bool("one-time", false, "disable the link after the first redirect")
+	params := fs.String("params", "", "query parameters added to the URL, like utm_source=newsletter&utm_campaign=spring, unless it already has them")
+	fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	redirect := urlshort.Redirect{
+		Path:          fs.Arg(0),
+		URL:           fs.Arg(1),
+		Status:        *status,
+		Title:         *title,
+		Preview:       *preview,
+		PreserveQuery: *preserveQuery,
+		MaxClicks:     *maxClicks,
+		OneTime:       *oneTime,
+	}
+
+	if *expires != "" {
+		t, err := parseExpires(*expires)
+		if err != nil {
+			return err
+		}
+		redirect.Expires = &t
+	}
+
+	if *params != "" {
+		var err error
+		if redirect.Params, err = urlshort.ParseParams(*params); err != nil {
+			return fmt.Errorf("invalid -params: %v", err)
+		}
+	}
+
+	if *password != "" {
+		hash, err := urlshort.HashPassword(*password)
+		if err != nil {
+			return err
+		}
+		redirect.Password = hash
+	}
+
+	return s.Put(redirect)
+}
+
+func rm(s *store, args []string) error {
+	fs := newFlagSet("rm <path>...")
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	for _, path := range fs.Args() {
+		if err := s.Delete(path); err != nil {
+			if err == urlshort.ErrNotFound {
+				return fmt.Errorf("%s: no such link", path)
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+func ls(s *store, args []string) error {
+	fs := newFlagSet("ls [flags]")
+	search := fs.String("search", "", "list only the links whose path or URL contains this text")
+	fs.Parse(args)
+
+	links, err := s.links()
+	if err != nil {
+		return err
+	}
+
+	found := []urlshort.Link{}
+	for _, link := range links {
+		if strings.Contains(link.Path, *search) || strings.Contains(link.URL, *search) {
+			found = append(found, link)
+		}
+	}
+
+	if s.json {
+		return printJSON(found)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprint(w, "PATH\tURL\tSTATUS")
+	if s.counter != nil {
+		fmt.Fprint(w, "\tCLICKS")
+	}
+	fmt.Fprintln(w)
+
+	for _, link := range found {
+		status := link.Status
+		if status == 0 {
+			status = 302
+		}
+
+		url := link.URL
+		for i, name := range link.TargetNames() {
+			if i > 0 {
+				url += " "
+			}
+			url += name + "=" + link.Targets[i].URL
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%d", link.Path, url, status)
+		if s.counter != nil {
+			fmt.Fprintf(w, "\t%d", link.Clicks)
+		}
+		fmt.Fprintln(w)
+	}
+
+	return w.Flush()
+}
+
+func stats(s *store, args []string) error {
+	fs := newFlagSet("stats [path...]")
+	fs.Parse(args)
+
+	if s.counter == nil {
+		return fmt.Errorf("the clicks are not available for this store")
+	}
+
+	var links []urlshort.Link
+	if fs.NArg() == 0 {
+		var err error
+		if links, err = s.links(); err != nil {
+			return err
+		}
+	}
+	for _, path := range fs.Args() {
+		clicks, err := s.counter.Count(path)
+		if err != nil {
+			return err
+		}
+		links = append(links, urlshort.Link{
+			Redirect: urlshort.Redirect{Path: path},
+			Clicks:   clicks,
+		})
+	}
+
+	// the most clicked first
+	sort.SliceStable(links, func(i, j int) bool {
+		return links[i].Clicks > links[j].Clicks
+	})
+
+	if s.json {
+		clicks := make(map[string]int64, len(links))
+		for _, link := range links {
+			clicks[link.Path] = link.Clicks
+			for name, variantClicks := range link.Variants {
+				clicks[link.Path+"#"+name] = variantClicks
+			}
+		}
+		return printJSON(clicks)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PATH\tCLICKS")
+	for _, link := range links {
+		fmt.Fprintf(w, "%s\t%d\n", link.Path, link.Clicks)
+		for _, name := range link.TargetNames() {
+			fmt.Fprintf(w, "  #%s\t%d\n", name, link.Variants[name])
+		}
+	}
+
+	return w.Flush()
+}
+
+func importLinks(s *store, args []string) error {
+	fs := newFlagSet("import [flags] <file>...")
+	format := fs.String("format", "", "format of the files (yaml|json|toml|csv|bookmarks), detected from their extension if omitted")
+	paths := fs.String("paths", "random", "paths given to the links without one, random or slug (derived from their title or URL)")
+	overwrite := fs.Bool("overwrite", false, "replace the existing links with the same paths")
+	dryRun := fs.Bool("dry-run", false, "only show what would be imported")
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	var links []urlshort.Redirect
+	for _, arg := range fs.Args() {
+		read, err := readLinks(arg, *format)
+		if err != nil {
+			return fmt.Errorf("%s: %v", arg, err)
+		}
+		links = append(links, read...)
+	}
+
+	existing, err := s.List()
+	if err != nil {
+		return err
+	}
+
+	results, err := urlshort.PlanImport(existing, links, urlshort.ImportOptions{
+		Paths:         *paths,
+		Overwrite:     *overwrite,
+		Normalization: s.normalization,
+	})
+	if err != nil {
+		return err
+	}
+
+	counts := make(map[string]int)
+	for _, result := range results {
+		counts[result.Action]++
+		if *dryRun || (result.Action != urlshort.ImportCreate && result.Action != urlshort.ImportReplace) {
+			fmt.Fprintln(os.Stderr, result)
+		}
+	}
+
+	// the store may still refuse some links, the others are imported
+	failed := 0
+	if !*dryRun {
+		for _, result := range results {
+			if result.Action != urlshort.ImportCreate && result.Action != urlshort.ImportReplace {
+				continue
+			}
+			if err := s.Put(result.Redirect); err != nil {
+				fmt.Fprintf(os.Stderr, "failed %s: %v\n", result.Redirect.Path, err)
+				counts[result.Action]--
+				failed++
+			}
+		}
+	}
+
+	verb := "imported"
+	if *dryRun {
+		verb = "to import"
+	}
+	fmt.Fprintf(os.Stderr, "%d links %s (%d new, %d replaced), %d duplicates, %d conflicts, %d invalid, %d failed\n",
+		counts[urlshort.ImportCreate]+counts[urlshort.ImportReplace], verb,
+		counts[urlshort.ImportCreate], counts[urlshort.ImportReplace],
+		counts[urlshort.ImportDuplicate], counts[urlshort.ImportConflict], counts[urlshort.ImportInvalid], failed)
+
+	if failed > 0 {
+		return fmt.Errorf("%d links not imported", failed)
+	}
+	return nil
+}
+
+// readLinks returns the links in the file at path: CSV and browser
+// bookmarks may leave their paths empty, the other formats are the
+// ones of the redirect data files.
+func readLinks(path, format string) ([]urlshort.Redirect, error) {
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".html", ".htm":
+			format = "bookmarks"
+		case ".csv":
+			format = "csv"
+		}
+	}
+
+	if format != "csv" && format != "bookmarks" {
+		redirects, conflicts, err := urlshort.LoadSources([]urlshort.Source{urlshort.ParseSource(path, format)})
+		for _, conflict := range conflicts {
+			fmt.Fprintf(os.Stderr, "conflict: %v\n", conflict)
+		}
+		return redirects, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if format == "bookmarks" {
+		return urlshort.ParseBookmarks(f)
+	}
+	return urlshort.ParseLinksCSV(f)
+}
+
+func export(s *store, args []string) error {
+	fs := newFlagSet("export [flags]")
+	format := fs.String("format", "yaml", "output format (yaml|json|toml|csv), or static hosting format (nginx|apache|netlify|html)")
+	output := fs.String("o", "", "output file, with the format detected from its extension if -format is not set (stdout if omitted), or directory of the html pages")
+	fs.Parse(args)
+
+	formatSet := false
+	fs.Visit(func(f *flag.Flag) {
+		formatSet = formatSet || f.Name == "format"
+	})
+
+	redirects, err := s.List()
+	if err != nil {
+		return err
+	}
+
+	if *format == "html" {
+		if *output == "" {
+			return fmt.Errorf("the html format needs an output directory with -o")
+		}
+
+		skipped, err := urlshort.ExportPages(*output, redirects)
+		printSkipped(skipped)
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		if !formatSet {
+			if *format, err = urlshort.FormatFromPath(*output); err != nil {
+				return err
+			}
+		}
+
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	for _, static := range urlshort.StaticFormats {
+		if *format == static {
+			skipped, err := urlshort.ExportStatic(w, redirects, *format)
+			printSkipped(skipped)
+			return err
+		}
+	}
+
+	return urlshort.WriteData(w, redirects, *format)
+}
+
+// printSkipped reports the links left out of a static export
+func printSkipped(skipped []urlshort.Skipped) {
+	for _, s := range skipped {
+		fmt.Fprintf(os.Stderr, "skipped %s\n", s)
+	}
+}
+
+func history(s *store, args []string) error {
+	fs := newFlagSet("history <path>")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	changes, err := s.history(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	if s.json {
+		return printJSON(changes)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tTIME\tACTOR\tACTION\tURL")
+	for i, c := range changes {
+		url := "-"
+		if c.New != nil {
+			url = c.New.URL
+		}
+
+		actor := c.Actor
+		if c.Claimed != "" && c.Claimed != c.Actor {
+			actor += " (claims " + c.Claimed + ")"
+		}
+
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", i+1, c.Time.Local().Format(time.RFC3339), actor, c.Action, url)
+	}
+
+	return w.Flush()
+}
+
+func rollback(s *store, args []string) error {
+	fs := newFlagSet("rollback [flags] <path>")
+	version := fs.Int("version", 0, "version to roll back to, as listed by history (the one before the last change if omitted)")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	changes, err := s.history(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	if *version == 0 {
+		if len(changes) < 2 {
+			return fmt.Errorf("%s: no previous version", fs.Arg(0))
+		}
+		*version = len(changes) - 1
+	}
+
+	return urlshort.Rollback(s, changes, *version)
+}
+
+func check(s *store, args []string) error {
+	fs := newFlagSet("check [flags]")
+	timeout := fs.Duration("timeout", 10*time.Second, "timeout of the request checking each target")
+	concurrency := fs.Int("concurrency", 8, "number of targets checked at once")
+	onlyBroken := fs.Bool("broken", false, "list only the broken targets")
+	fs.Parse(args)
+
+	redirects, err := s.List()
+	if err != nil {
+		return err
+	}
+
+	results := urlshort.NewChecker(*timeout, *concurrency).Check(redirects)
+
+	broken := 0
+	listed := []urlshort.CheckResult{}
+	for _, result := range results {
+		if result.Broken {
+			broken++
+		}
+		if result.Broken || !*onlyBroken {
+			listed = append(listed, result)
+		}
+	}
+
+	if s.json {
+		if err := printJSON(listed); err != nil {
+			return err
+		}
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "PATH\tSTATUS\tURL\tERROR")
+		for _, result := range listed {
+			status := "-"
+			if result.Status != 0 {
+				status = strconv.Itoa(result.Status)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", result.Path, status, result.URL, result.Error)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if broken > 0 {
+		return fmt.Errorf("%d of %d links are broken", broken, len(results))
+	}
+
+	return nil
+}
+
+// links returns all the links along with their clicks, if available
+func (s *store) links() ([]urlshort.Link, error) {
+	// the admin API returns them at once
+	if client, ok := s.WritableStore.(*urlshort.APIClient); ok {
+		return client.Links()
+	}
+
+	redirects, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+
+	links := make([]urlshort.Link, len(redirects))
+	for i, redirect := range redirects {
+		links[i].Redirect = redirect
+		if s.counter != nil {
+			if links[i], err = urlshort.CountClicks(redirect, s.counter); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return links, nil
+}
+
+// history returns the changes of the link for path,
+// if the store keeps track of them
+func (s *store) history(path string) ([]urlshort.Change, error) {
+	h, ok := s.WritableStore.(urlshort.History)
+	if !ok {
+		return nil, fmt.Errorf("no audit log, set -audit-log")
+	}
+
+	changes, err := h.History(path)
+	if err == urlshort.ErrNotFound {
+		// only returned by the admin API
+		return nil, fmt.Errorf("the server keeps no audit log")
+	}
+	if err == nil && len(changes) == 0 {
+		return nil, fmt.Errorf("%s: no changes recorded", path)
+	}
+	return changes, err
+}
+
+func newFlagSet(usage string) *flag.FlagSet {
+	fs := flag.NewFlagSet(strings.Fields(usage)[0], flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: urlshort [flags] %s\n", usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseExpires parses s as a RFC 3339 time
+// or as a duration from now
+func parseExpires(s string) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(d).Truncate(time.Second), nil
+	}
+
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid expiration %q, expected a RFC 3339 time or a duration", s)
+	}
+
+	return t, nil
+}
+
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "\t")
+	return enc.Encode(v)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"gophercises/urlshort"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAddGuarded(t *testing.T) {
+	dir, err := ioutil.TempDir("", "urlshort")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fileStore, err := urlshort.NewFileStore(filepath.Join(dir, "redirects.yml"), "")
+	if err != nil {
+		t.Fatalf("NewFileStore failed with error %v\n", err)
+	}
+
+	chains := urlshort.Chains{Hosts: []string{"go.example.com"}}
+	s := &store{WritableStore: guard(fileStore, chains, urlshort.Normalization{FoldCase: true}, false)}
+
+	if err := add(s, []string{"/a", "https://go.example.com/b"}); err != nil {
+		t.Fatalf("add failed with error %v\n", err)
+	}
+
+	// /B leads back to /a once normalized
+	err = add(s, []string{"/B", "https://go.example.com/a"})
+	if _, ok := err.(*urlshort.ChainError); !ok {
+		t.Errorf("Expected a ChainError creating a loop, got %v\n", err)
+	}
+	if _, err := fileStore.Get("/b"); err != urlshort.ErrNotFound {
+		t.Errorf("Expected /b not to be stored, got %v\n", err)
+	}
+
+	// like in Redis or bbolt
+	s = &store{WritableStore: guard(fileStore, chains, urlshort.Normalization{}, true)}
+	err = add(s, []string{"/gh/:user", "https://github.com/:user"})
+	if _, ok := err.(*urlshort.PatternError); !ok {
+		t.Errorf("Expected a PatternError adding a pattern to a store of exact paths, got %v\n", err)
+	}
+}
@@ -0,0 +1,244 @@
+// Command urlshort manages the redirects served by the urlshort
+// server, either directly in their store (a file, Redis or a bbolt
+// database) or through the admin API of a running server.
+//
+// Usage:
+//
+//	urlshort [flags] <command> [arguments]
+//
+// The commands are:
+//
+//	add       creates or replaces a link
+//	rm        removes links
+//	ls        lists the links
+//	stats     shows the clicks of the links
+//	import    imports links from files, CSV or browser bookmarks
+//	export    exports the links to a file, or to static hosting configuration
+//	check     checks that the targets of the links are reachable
+//	history   shows the changes of a link
+//	rollback  rolls a link back to a previous version
+//
+// Run "urlshort <command> -h" for the flags of each command.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"gophercises/urlshort"
+	"net/url"
+	"os"
+	"os/user"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// store is the store managed by the commands, along with the
+// Counter of its clicks, nil if they are not available
+type store struct {
+	urlshort.WritableStore
+	counter       urlshort.Counter
+	normalization urlshort.Normalization // the one of -normalize
+	json          bool
+	close         func() error
+}
+
+type command struct {
+	name  string
+	usage string
+	run   func(s *store, args []string) error
+}
+
+var commands = []command{
+	{"add", "add [flags] <path> <url>", add},
+	{"rm", "rm <path>...", rm},
+	{"ls", "ls [flags]", ls},
+	{"stats", "stats [path...]", stats},
+	{"import", "import [flags] <file>...", importLinks},
+	{"export", "export [flags]", export},
+	{"check", "check [flags]", check},
+	{"history", "history <path>", history},
+	{"rollback", "rollback [flags] <path>", rollback},
+}
+
+func main() {
+	server := flag.String("server", "", "base URL of the admin API of a running server, like http://localhost:8081")
+	token := flag.String("token", os.Getenv("URLSHORT_TOKEN"), "token of the admin API (defaults to $URLSHORT_TOKEN)")
+	file := flag.String("file", "", "file containing the redirects map")
+	format := flag.String("format", "", "format of -file (yaml|json|toml|csv), detected from the file extension if omitted")
+
+	var redisOpts urlshort.RedisOptions
+	flag.StringVar(&redisOpts.Addr, "redis-addr", "", "address of the Redis server")
+	flag.StringVar(&redisOpts.Password, "redis-password", "", "password of the Redis server")
+	flag.IntVar(&redisOpts.DB, "redis-db", 0, "Redis database number")
+	redisKey := flag.String("redis-key", "urlshort", "key of the Redis hash containing the redirects map")
+
+	boltPath := flag.String("bolt", "", "bbolt database containing the redirects map")
+	boltBucket := flag.String("bolt-bucket", "urlshort", "bucket of the bbolt database containing the redirects map")
+
+	normalize := flag.String("normalize", "", "path normalizations of the server, applied to the paths of the links of -file, -redis-addr or -bolt: case, slash, collapse, decode (see the -normalize flag of the server)")
+	baseURL := flag.String("base-url", "", "scheme and host of the short links, like https://go.example.com (see the -base-url flag of the server)")
+	localHosts := flag.String("local-hosts", "", "comma separated list of the hosts of the short links, besides the one of -base-url: targets on them are followed to detect loops in the links of -file, -redis-addr or -bolt")
+	collapseChains := flag.Bool("collapse-chains", false, "replace the targets leading to other short links with their final destination")
+	auditLog := flag.String("audit-log", "", "file of the audit log recording the changes made to the links of -file, -redis-addr or -bolt")
+
+	jsonOutput := flag.Bool("json", false, "print JSON instead of tables")
+
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	var cmd *command
+	for i := range commands {
+		if commands[i].name == flag.Arg(0) {
+			cmd = &commands[i]
+		}
+	}
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "urlshort: unknown command %q\n", flag.Arg(0))
+		usage()
+		os.Exit(2)
+	}
+
+	s := &store{json: *jsonOutput}
+	selected := 0
+	if *server != "" {
+		client := urlshort.NewAPIClient(*server, *token).As(actor())
+		s.WritableStore, s.counter = client, client
+		selected++
+	}
+	if *file != "" {
+		fileStore, err := urlshort.NewFileStore(*file, *format)
+		if err != nil {
+			fatal(err)
+		}
+		s.WritableStore = fileStore
+		selected++
+	}
+	if redisOpts.Addr != "" {
+		redisOpts.PoolSize = 1
+		redisOpts.Timeout = 5 * time.Second
+		p, err := urlshort.NewRedisPool(redisOpts)
+		if err != nil {
+			fatal(err)
+		}
+		redisStore := urlshort.NewRedisStore(p, *redisKey)
+		s.WritableStore, s.counter = redisStore, redisStore
+		selected++
+	}
+	if *boltPath != "" {
+		db, err := bolt.Open(*boltPath, 0644, &bolt.Options{Timeout: time.Second})
+		if err != nil {
+			fatal(fmt.Errorf("cannot open %s (is the server using it?): %v", *boltPath, err))
+		}
+		s.close = db.Close
+
+		boltStore, err := urlshort.NewBoltStore(db, *boltBucket)
+		if err != nil {
+			fatal(err)
+		}
+		s.WritableStore, s.counter = boltStore, boltStore
+		selected++
+	}
+	if selected != 1 {
+		fmt.Fprintln(os.Stderr, "urlshort: exactly one of -server, -file, -redis-addr or -bolt is required")
+		os.Exit(2)
+	}
+
+	var normalization urlshort.Normalization
+	if *normalize != "" {
+		var err error
+		if normalization, err = urlshort.ParseNormalization(*normalize); err != nil {
+			fatal(err)
+		}
+	}
+
+	hosts := splitList(*localHosts)
+	if u, err := url.Parse(*baseURL); err == nil && u.Host != "" {
+		hosts = append(hosts, u.Host)
+	}
+
+	if *server != "" {
+		if *normalize != "" || len(hosts) > 0 || *collapseChains {
+			fmt.Fprintln(os.Stderr, "urlshort: with -server the paths are normalized and the chains resolved by the server")
+			os.Exit(2)
+		}
+	} else {
+		chains := urlshort.Chains{Hosts: hosts, Collapse: *collapseChains}
+		s.WritableStore = guard(s.WritableStore, chains, normalization, *file == "")
+		s.normalization = normalization
+	}
+
+	if *auditLog != "" {
+		if *server != "" {
+			fmt.Fprintln(os.Stderr, "urlshort: with -server the audit log is kept by the server")
+			os.Exit(2)
+		}
+
+		l, err := urlshort.OpenAuditLog(*auditLog)
+		if err != nil {
+			fatal(err)
+		}
+		defer l.Close()
+		s.WritableStore = urlshort.Audit(s.WritableStore, l, actor()).Normalizing(normalization)
+	}
+
+	err := cmd.run(s, flag.Args()[1:])
+	if s.close != nil {
+		s.close()
+	}
+	if err != nil {
+		fatal(err)
+	}
+}
+
+// guard returns ws checking the links put in it like the admin API
+// of the server does: their paths are normalized as described by n
+// before their chains are resolved as described by chains, and the
+// patterns are refused if exact is true, for the stores matching
+// only exact paths
+func guard(ws urlshort.WritableStore, chains urlshort.Chains, n urlshort.Normalization, exact bool) urlshort.WritableStore {
+	ws = urlshort.NormalizeStore(urlshort.ChainGuard(ws, chains, n, nil), n)
+	if exact {
+		ws = urlshort.ExactPaths(ws)
+	}
+	return ws
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: urlshort [flags] <command> [arguments]\n\nCommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %s\n", cmd.usage)
+	}
+	fmt.Fprintf(os.Stderr, "\nFlags:\n")
+	flag.PrintDefaults()
+}
+
+// actor returns the name of the user running the
+// command, recorded as the author of the changes
+func actor() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+func fatal(err error) {
+	fmt.Fprintf(os.Stderr, "urlshort: %v\n", err)
+	os.Exit(1)
+}
@@ -0,0 +1,43 @@
+package urlshort
+
+import "sync"
+
+// Counter is the interface implemented by the backends
+// keeping the number of clicks of each link.
+//
+// Incr increments the clicks of path, returning the new count.
+// Count returns the clicks of path.
+type Counter interface {
+	Incr(path string) (int64, error)
+	Count(path string) (int64, error)
+}
+
+// MemoryCounter is a Counter keeping the clicks in memory
+type MemoryCounter struct {
+	mu     sync.Mutex
+	clicks map[string]int64
+}
+
+// NewMemoryCounter returns an empty MemoryCounter
+func NewMemoryCounter() *MemoryCounter {
+	return &MemoryCounter{
+		clicks: make(map[string]int64),
+	}
+}
+
+// Incr increments the clicks of path
+func (c *MemoryCounter) Incr(path string) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.clicks[path]++
+	return c.clicks[path], nil
+}
+
+// Count returns the clicks of path
+func (c *MemoryCounter) Count(path string) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.clicks[path], nil
+}
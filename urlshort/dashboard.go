@@ -0,0 +1,399 @@
+package urlshort
+
+import (
+	"crypto/rand"
+	"fmt"
+	"html/template"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Dashboard will return an http.HandlerFunc (which also implements
+// http.Handler) serving an HTML interface to manage the redirects of
+// store, meant to be mounted at the root of an admin server:
+//
+//	/            lists the links, searching them with the q parameter
+//	/new         creates a link, with a random path unless given one
+//	/edit?path=  edits the target, title and status of a link
+//	/toggle      disables or enables a link (POST only)
+//
+// The clicks are read from counter, if not nil, and onChange, if not
+// nil, is called with the path of each link created or changed.
+// The dashboard has no authentication of its own, wrap it with
+// BasicAuth or RequireToken.
+func Dashboard(store WritableStore, counter Counter, onChange func(path string)) http.HandlerFunc {
+	d := &dashboard{admin{
+		store:    store,
+		counter:  counter,
+		onChange: onChange,
+	}}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && !sameOrigin(r) {
+			http.Error(w, "403 cross-origin request refused", http.StatusForbidden)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/":
+			d.list(w, r)
+		case "/new":
+			d.create(w, r)
+		case "/edit":
+			d.edit(w, r)
+		case "/toggle":
+			d.toggle(w, r)
+		default:
+			http.NotFound(w, r)
+		}
+	}
+}
+
+type dashboard struct {
+	admin
+}
+
+// linkRow is a link as shown in the list
+type linkRow struct {
+	Link
+	State   string
+	Targets []string
+}
+
+func (d *dashboard) list(w http.ResponseWriter, r *http.Request) {
+	redirects, err := d.store.List()
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	search := strings.ToLower(query)
+
+	var rows []linkRow
+	for _, redirect := range redirects {
+		if search != "" && !strings.Contains(strings.ToLower(redirect.Path+" "+redirect.URL+" "+redirect.Title), search) {
+			continue
+		}
+
+		link, err := d.link(redirect)
+		if err != nil {
+			storeError(w, err)
+			return
+		}
+
+		state := "active"
+		switch {
+		case redirect.Disabled:
+			state = "disabled"
+		case redirect.expired():
+			state = "expired"
+		}
+
+		rows = append(rows, linkRow{Link: link, State: state, Targets: describeTargets(link)})
+	}
+
+	renderDashboard(w, http.StatusOK, dashboardList, struct {
+		Title  string
+		Query  string
+		Rows   []linkRow
+		Clicks bool
+	}{"Links", query, rows, d.counter != nil})
+}
+
+// linkForm holds the fields of the create and edit forms
+type linkForm struct {
+	Title     string
+	New       bool
+	Path      string
+	URL       string
+	Targets   []string
+	LinkTitle string
+	Status    int
+	Statuses  []int
+	Error     string
+}
+
+func (d *dashboard) create(w http.ResponseWriter, r *http.Request) {
+	form := linkForm{Title: "New link", New: true, Statuses: validStatuses}
+	if r.Method != http.MethodPost {
+		renderDashboard(w, http.StatusOK, dashboardForm, form)
+		return
+	}
+
+	form.Path = strings.TrimSpace(r.PostFormValue("path"))
+	form.URL = strings.TrimSpace(r.PostFormValue("url"))
+	form.LinkTitle = strings.TrimSpace(r.PostFormValue("title"))
+	form.Status, _ = strconv.Atoi(r.PostFormValue("status"))
+
+	if form.Path != "" && !strings.HasPrefix(form.Path, "/") {
+		form.Path = "/" + form.Path
+	}
+
+	if form.Path == "" {
+		path, err := d.randomPath()
+		if err != nil {
+			storeError(w, err)
+			return
+		}
+		form.Path = path
+	} else if _, err := d.store.Get(form.Path); err == nil {
+		form.Error = "The path " + form.Path + " is already taken."
+		renderDashboard(w, http.StatusConflict, dashboardForm, form)
+		return
+	} else if err != ErrNotFound {
+		storeError(w, err)
+		return
+	}
+
+	d.save(w, r, Redirect{
+		Path:   form.Path,
+		URL:    form.URL,
+		Title:  form.LinkTitle,
+		Status: form.Status,
+	}, form)
+}
+
+func (d *dashboard) edit(w http.ResponseWriter, r *http.Request) {
+	path := r.FormValue("path")
+	redirect, err := d.store.Get(path)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+
+	form := linkForm{
+		Title:     "Edit " + path,
+		Path:      path,
+		URL:       redirect.URL,
+		Targets:   describeTargets(Link{Redirect: redirect}),
+		LinkTitle: redirect.Title,
+		Status:    redirect.Status,
+		Statuses:  validStatuses,
+	}
+	if r.Method != http.MethodPost {
+		renderDashboard(w, http.StatusOK, dashboardForm, form)
+		return
+	}
+
+	form.URL = strings.TrimSpace(r.PostFormValue("url"))
+	form.LinkTitle = strings.TrimSpace(r.PostFormValue("title"))
+	form.Status, _ = strconv.Atoi(r.PostFormValue("status"))
+
+	// keep the fields not shown in the form, the targets
+	// of a split link unless it's given a single URL
+	redirect.URL = form.URL
+	if form.URL != "" {
+		redirect.Targets = nil
+	}
+	redirect.Title = form.LinkTitle
+	redirect.Status = form.Status
+
+	d.save(w, r, redirect, form)
+}
+
+func (d *dashboard) toggle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "405 method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	redirect, err := d.store.Get(r.PostFormValue("path"))
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+
+	redirect.Disabled = !redirect.Disabled
+	if err := d.storeFor(r).Put(redirect); err != nil {
+		storeError(w, err)
+		return
+	}
+	d.changed(redirect.Path)
+
+	http.Redirect(w, r, "/?q="+url.QueryEscape(r.PostFormValue("q")), http.StatusSeeOther)
+}
+
+// save stores redirect, showing again form with
+// the error if it's invalid
+func (d *dashboard) save(w http.ResponseWriter, r *http.Request, redirect Redirect, form linkForm) {
+	if redirect.Status == http.StatusFound {
+		// the default one
+		redirect.Status = 0
+	}
+
+	if err := redirect.validate(); err != nil {
+		form.Error = err.Error()
+		renderDashboard(w, http.StatusBadRequest, dashboardForm, form)
+		return
+	}
+
+	if err := d.storeFor(r).Put(redirect); err != nil {
+		switch err.(type) {
+		case *ChainError, *PatternError:
+			form.Error = err.Error()
+			renderDashboard(w, http.StatusBadRequest, dashboardForm, form)
+			return
+		case *PathConflictError:
+			form.Error = err.Error()
+			renderDashboard(w, http.StatusConflict, dashboardForm, form)
+			return
+		}
+		storeError(w, err)
+		return
+	}
+	d.changed(redirect.Path)
+
+	http.Redirect(w, r, "/?q="+url.QueryEscape(redirect.Path), http.StatusSeeOther)
+}
+
+const (
+	randomPathChars  = "abcdefghijkmnopqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	randomPathLength = 6
+)
+
+// describeTargets returns the targets of a link splitting its
+// visitors, with their weights and clicks if known
+func describeTargets(link Link) []string {
+	var targets []string
+	for i, t := range link.Targets {
+		target := fmt.Sprintf("%s: %s (weight %d", t.name(i), t.URL, t.weight())
+		if clicks, ok := link.Variants[t.name(i)]; ok {
+			target += fmt.Sprintf(", %d clicks", clicks)
+		}
+		targets = append(targets, target+")")
+	}
+	return targets
+}
+
+// randomPath returns a random path not used in the store yet
+func (d *dashboard) randomPath() (string, error) {
+	for {
+		path, err := RandomPath(randomPathLength)
+		if err != nil {
+			return "", err
+		}
+
+		if _, err := d.store.Get(path); err == ErrNotFound {
+			return path, nil
+		} else if err != nil {
+			return "", err
+		}
+	}
+}
+
+// RandomPath returns a random path of n letters and digits,
+// leaving out the ones easily mistaken for each other
+func RandomPath(n int) (string, error) {
+	b := make([]byte, n)
+	max := big.NewInt(int64(len(randomPathChars)))
+	for i := range b {
+		c, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b[i] = randomPathChars[c.Int64()]
+	}
+
+	return "/" + string(b), nil
+}
+
+// sameOrigin reports if r comes from a page of the same host,
+// according to its Origin header, if any
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return r.Header.Get("Sec-Fetch-Site") != "cross-site"
+	}
+
+	u, err := url.Parse(origin)
+	return err == nil && u.Host == r.Host
+}
+
+var validStatuses = []int{http.StatusFound, http.StatusMovedPermanently, http.StatusTemporaryRedirect, http.StatusPermanentRedirect}
+
+func renderDashboard(w http.ResponseWriter, status int, tmpl *template.Template, data interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	tmpl.Execute(w, data)
+}
+
+const dashboardHeader = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}} - urlshort</title>
+<style>
+body { font-family: sans-serif; max-width: 60em; margin: 2em auto; padding: 0 1em; }
+nav a { margin-right: 1em; }
+table { border-collapse: collapse; width: 100%; }
+th, td { text-align: left; padding: .4em; border-bottom: 1px solid #ddd; }
+td.url { word-break: break-all; font-family: monospace; }
+tr.disabled, tr.expired { color: #888; }
+label { display: block; margin: .8em 0 .2em; }
+input[type=text], input[type=url] { width: 100%; }
+.error { color: #c5221f; }
+form.inline { display: inline; }
+</style>
+</head>
+<body>
+<nav><a href="/">Links</a><a href="/new">New link</a></nav>
+<h1>{{.Title}}</h1>`
+
+var dashboardList = template.Must(template.New("list").Parse(dashboardHeader + `
+<form method="get" action="/">
+<input type="text" name="q" value="{{.Query}}" placeholder="Search paths, URLs and titles" autofocus>
+</form>
+<table>
+<tr><th>Path</th><th>URL</th><th>Status</th>{{if .Clicks}}<th>Clicks</th>{{end}}<th>State</th><th></th></tr>
+{{range .Rows}}
+<tr class="{{.State}}">
+<td><a href="/edit?path={{.Path}}">{{.Path}}</a>{{with .Title}}<br><small>{{.}}</small>{{end}}</td>
+<td class="url">{{.URL}}{{range $i, $t := .Targets}}{{if $i}}<br>{{end}}{{$t}}{{end}}</td>
+<td>{{if .Status}}{{.Status}}{{else}}302{{end}}</td>
+{{if $.Clicks}}<td>{{.Clicks}}</td>{{end}}
+<td>{{.State}}</td>
+<td><form class="inline" method="post" action="/toggle">
+<input type="hidden" name="path" value="{{.Path}}">
+<input type="hidden" name="q" value="{{$.Query}}">
+<button type="submit">{{if .Disabled}}Enable{{else}}Disable{{end}}</button>
+</form></td>
+</tr>
+{{else}}
+<tr><td colspan="6">No links found.</td></tr>
+{{end}}
+</table>
+` + pageFooter))
+
+var dashboardForm = template.Must(template.New("form").Parse(dashboardHeader + `
+{{with .Error}}<p class="error">{{.}}</p>{{end}}
+<form method="post">
+{{if .New}}
+<label for="path">Path (leave empty for a random one)</label>
+<input type="text" id="path" name="path" value="{{.Path}}">
+{{else}}
+<input type="hidden" name="path" value="{{.Path}}">
+{{end}}
+{{if .Targets}}
+<p>Split among:</p>
+<ul>{{range .Targets}}<li>{{.}}</li>{{end}}</ul>
+<label for="url">URL (replaces the targets)</label>
+<input type="url" id="url" name="url" value="{{.URL}}">
+{{else}}
+<label for="url">URL</label>
+<input type="url" id="url" name="url" value="{{.URL}}" required>
+{{end}}
+<label for="title">Title</label>
+<input type="text" id="title" name="title" value="{{.LinkTitle}}">
+<label for="status">Redirect</label>
+<select id="status" name="status">
+{{range .Statuses}}<option value="{{.}}"{{if eq . $.Status}} selected{{end}}>{{.}}</option>{{end}}
+</select>
+<p><button type="submit">Save</button></p>
+</form>
+` + pageFooter))
@@ -0,0 +1,100 @@
+package urlshort
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDashboard(t *testing.T) {
+	dir, err := ioutil.TempDir("", "urlshort")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := NewFileStore(filepath.Join(dir, "redirects.json"), "")
+	if err != nil {
+		t.Fatalf("NewFileStore failed with error %v\n", err)
+	}
+	h := Dashboard(store, NewMemoryCounter(), nil)
+
+	post := func(path string, form url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := post("/new", url.Values{"path": {"docs"}, "url": {"https://example.com/docs"}, "status": {"302"}})
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("Expected status 303 creating /docs, got %v:\n%s\n", rec.Code, rec.Body)
+	}
+	if redirect, err := store.Get("/docs"); err != nil || redirect.Status != 0 {
+		t.Errorf("Unexpected redirect %+v, error %v\n", redirect, err)
+	}
+
+	rec = post("/new", url.Values{"path": {"/docs"}, "url": {"https://example.com/other"}})
+	if rec.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 creating /docs again, got %v\n", rec.Code)
+	}
+
+	rec = post("/new", url.Values{"url": {"https://example.com/random"}})
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("Expected status 303 creating a random path, got %v:\n%s\n", rec.Code, rec.Body)
+	}
+
+	rec = post("/edit", url.Values{"path": {"/docs"}, "url": {"not a url"}})
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 saving an invalid URL, got %v\n", rec.Code)
+	}
+
+	if rec = post("/toggle", url.Values{"path": {"/docs"}}); rec.Code != http.StatusSeeOther {
+		t.Errorf("Expected status 303 toggling /docs, got %v\n", rec.Code)
+	}
+	if redirect, _ := store.Get("/docs"); !redirect.Disabled {
+		t.Errorf("Expected /docs to be disabled\n")
+	}
+
+	redirects, _ := store.List()
+	if len(redirects) != 2 {
+		t.Errorf("Expected 2 links, got %+v\n", redirects)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/?q=DOCS", nil))
+	body := rec.Body.String()
+	if !strings.Contains(body, "https://example.com/docs") || !strings.Contains(body, "disabled") ||
+		strings.Contains(body, "https://example.com/random") {
+		t.Errorf("Unexpected search results:\n%s\n", body)
+	}
+
+	req := httptest.NewRequest("POST", "/toggle", strings.NewReader("path=/docs"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Origin", "https://evil.example.com")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 for a cross-origin request, got %v\n", rec.Code)
+	}
+}
+
+func TestDisabledLink(t *testing.T) {
+	h, err := DataHandler([]byte(`[{"path": "/a", "url": "https://example.com/a", "disabled": true}]`), "json", http.NotFoundHandler())
+	if err != nil {
+		t.Fatalf("DataHandler failed with error %v\n", err)
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/a", nil))
+	if rec.Code != http.StatusGone {
+		t.Errorf("Expected status 410 for a disabled link, got %v\n", rec.Code)
+	}
+}
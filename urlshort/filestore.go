@@ -0,0 +1,173 @@
+package urlshort
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// FileStore is a WritableStore keeping the redirects in a file, in
+// one of the formats supported by DataHandler.
+// Each change rewrites the whole file, so it's meant to manage the
+// files served by a FileHandler, which will pick up the changes.
+type FileStore struct {
+	path   string
+	format string
+
+	mu sync.Mutex // serializes the changes
+}
+
+// NewFileStore returns a FileStore using the file at path, in the
+// given format or, if empty, in the one matching its extension.
+// The file is created on the first change if it doesn't exist.
+func NewFileStore(path, format string) (*FileStore, error) {
+	if format == "" {
+		var err error
+		if format, err = FormatFromPath(path); err != nil {
+			return nil, err
+		}
+	}
+
+	return &FileStore{
+		path:   path,
+		format: format,
+	}, nil
+}
+
+// Get returns the redirect for path
+func (s *FileStore) Get(path string) (Redirect, error) {
+	redirects, err := s.read()
+	if err != nil {
+		return Redirect{}, err
+	}
+
+	for _, redirect := range redirects {
+		if redirect.Path == path {
+			return redirect, nil
+		}
+	}
+
+	return Redirect{}, ErrNotFound
+}
+
+// List returns all the redirects in the file, ordered by path
+func (s *FileStore) List() ([]Redirect, error) {
+	redirects, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(redirects, func(i, j int) bool {
+		return redirects[i].Path < redirects[j].Path
+	})
+
+	return redirects, nil
+}
+
+// Put adds redirect to the file, replacing the one with the same
+// path if any. It returns a *PathConflictError if another path
+// matches the same requests.
+func (s *FileStore) Put(redirect Redirect) error {
+	if err := redirect.validate(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	redirects, err := s.read()
+	if err != nil {
+		return err
+	}
+
+	replaced := false
+	for i := range redirects {
+		switch {
+		case redirects[i].Path == redirect.Path:
+			redirects[i] = redirect
+			replaced = true
+		case routeKey(redirects[i].Path) == routeKey(redirect.Path):
+			return &PathConflictError{Path: redirect.Path, Other: redirects[i].Path}
+		}
+	}
+	if !replaced {
+		redirects = append(redirects, redirect)
+	}
+
+	// the file must still be loadable by DataHandler
+	if err := validate(redirects); err != nil {
+		return err
+	}
+
+	return s.write(redirects)
+}
+
+// Delete removes the redirect for path from the file
+func (s *FileStore) Delete(path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	redirects, err := s.read()
+	if err != nil {
+		return err
+	}
+
+	kept := redirects[:0]
+	for _, redirect := range redirects {
+		if redirect.Path != path {
+			kept = append(kept, redirect)
+		}
+	}
+
+	if len(kept) == len(redirects) {
+		return ErrNotFound
+	}
+
+	return s.write(kept)
+}
+
+func (s *FileStore) read() ([]Redirect, error) {
+	data, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return parseData(data, s.format)
+}
+
+// write replaces the file with a new one holding redirects, so
+// that readers never see a partially written file
+func (s *FileStore) write(redirects []Redirect) error {
+	var buf bytes.Buffer
+	if err := WriteData(&buf, redirects, s.format); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if info, err := os.Stat(s.path); err == nil {
+		os.Chmod(tmp.Name(), info.Mode())
+	} else {
+		os.Chmod(tmp.Name(), 0644)
+	}
+
+	return os.Rename(tmp.Name(), s.path)
+}
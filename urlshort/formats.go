@@ -0,0 +1,125 @@
+package urlshort
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/go-yaml/yaml"
+)
+
+// FormatFromPath returns the data format matching the
+// extension of the file at path
+func FormatFromPath(path string) (string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yml", ".yaml":
+		return "yaml", nil
+	case ".json":
+		return "json", nil
+	case ".toml":
+		return "toml", nil
+	case ".csv":
+		return "csv", nil
+	}
+
+	return "", fmt.Errorf("cannot detect the format of %s from its extension", path)
+}
+
+func parseTOML(data []byte) ([]Redirect, error) {
+	var parsedData struct {
+		Redirects []Redirect `toml:"redirect"`
+	}
+
+	if err := toml.Unmarshal(data, &parsedData); err != nil {
+		return nil, err
+	}
+
+	return parsedData.Redirects, nil
+}
+
+func parseCSV(data []byte) ([]Redirect, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = 2
+	r.TrimLeadingSpace = true
+
+	var redirects []Redirect
+	for line := 1; ; line++ {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		path, url := strings.TrimSpace(record[0]), strings.TrimSpace(record[1])
+		if line == 1 && strings.EqualFold(path, "path") && strings.EqualFold(url, "url") {
+			continue
+		}
+
+		redirects = append(redirects, Redirect{Path: path, URL: url})
+	}
+
+	return redirects, nil
+}
+
+// WriteData writes redirects to w in one of the formats supported
+// by DataHandler, so that they can be read back by it.
+// CSV can hold only paths and URLs, an error is returned if any of
+// the redirects has other fields set.
+func WriteData(w io.Writer, redirects []Redirect, format string) error {
+	if redirects == nil {
+		redirects = []Redirect{}
+	}
+
+	switch format {
+	case "yaml":
+		data, err := yaml.Marshal(redirects)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "\t")
+		return enc.Encode(redirects)
+	case "toml":
+		return toml.NewEncoder(w).Encode(struct {
+			Redirects []Redirect `toml:"redirect"`
+		}{redirects})
+	case "csv":
+		return writeCSV(w, redirects)
+	}
+
+	return fmt.Errorf("unsupported data format %s", format)
+}
+
+func writeCSV(w io.Writer, redirects []Redirect) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"path", "url"})
+
+	for _, redirect := range redirects {
+		if redirect.hasOptions() {
+			return fmt.Errorf("path %s has options not supported by the csv format", redirect.Path)
+		}
+		cw.Write([]string{redirect.Path, redirect.URL})
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// hasOptions reports if any field besides Path and URL is set
+func (rd Redirect) hasOptions() bool {
+	// all the optional fields are omitted when empty
+	full, _ := json.Marshal(rd)
+	plain, _ := json.Marshal(Redirect{Path: rd.Path, URL: rd.URL})
+
+	return !bytes.Equal(full, plain)
+}
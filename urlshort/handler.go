@@ -3,30 +3,124 @@ package urlshort
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
 
 	"github.com/go-yaml/yaml"
+	"golang.org/x/crypto/bcrypt"
 )
 
+// now is used to check for expired redirects,
+// it can be replaced by tests
+var now = time.Now
+
+// Redirect holds a single entry of the redirect table.
+//
+// Status is the HTTP status code used to redirect, one of 301, 302,
+// 307 or 308. If zero, 302 will be used.
+// After the Expires timestamp the link returns 410 Gone instead of
+// redirecting.
+// If PreserveQuery is true, the query string of the incoming request
+// is appended to the one of the target URL.
+// If Preview is true, a page showing the Title and the URL of the
+// link is served instead of redirecting.
+// If Password is set, it must be a hash returned by HashPassword and
+// the visitors have to enter the password before being redirected.
+// After MaxClicks redirects, or the first one if OneTime is true,
+// the link returns 410 Gone.
+// If Disabled is true, the link returns 410 Gone too.
+// If Targets is set, URL must be empty and the visitors are split
+// among the targets, see Target.
+// The Rules are checked in order, the first one matching the request
+// gives the URL to redirect to, the default one if none matches.
+// The Params are added to the query of the URL, unless it already
+// has them or the visitor passes them with PreserveQuery.
+type Redirect struct {
+	Path          string            `yaml:"path" json:"path" toml:"path"`
+	URL           string            `yaml:"url" json:"url" toml:"url"`
+	Status        int               `yaml:"status,omitempty" json:"status,omitempty" toml:"status,omitempty"`
+	Expires       *time.Time        `yaml:"expires,omitempty" json:"expires,omitempty" toml:"expires,omitempty"`
+	PreserveQuery bool              `yaml:"preserve_query,omitempty" json:"preserve_query,omitempty" toml:"preserve_query,omitempty"`
+	Title         string            `yaml:"title,omitempty" json:"title,omitempty" toml:"title,omitempty"`
+	Preview       bool              `yaml:"preview,omitempty" json:"preview,omitempty" toml:"preview,omitempty"`
+	Password      string            `yaml:"password,omitempty" json:"password,omitempty" toml:"password,omitempty"`
+	MaxClicks     int               `yaml:"max_clicks,omitempty" json:"max_clicks,omitempty" toml:"max_clicks,omitempty"`
+	OneTime       bool              `yaml:"one_time,omitempty" json:"one_time,omitempty" toml:"one_time,omitempty"`
+	Disabled      bool              `yaml:"disabled,omitempty" json:"disabled,omitempty" toml:"disabled,omitempty"`
+	Targets       []Target          `yaml:"targets,omitempty" json:"targets,omitempty" toml:"targets,omitempty"`
+	Rules         []Rule            `yaml:"rules,omitempty" json:"rules,omitempty" toml:"rules,omitempty"`
+	Params        map[string]string `yaml:"params,omitempty" json:"params,omitempty" toml:"params,omitempty"`
+}
+
+// ServeHTTP redirects the request to the URL of the Redirect
+func (rd Redirect) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	defaultOptions.serve(w, r, rd, false)
+}
+
+func (rd Redirect) expired() bool {
+	return rd.Expires != nil && now().After(*rd.Expires)
+}
+
+// status returns the status code of the redirect, 302 by default
+func (rd Redirect) status() int {
+	if rd.Status == 0 {
+		return http.StatusFound
+	}
+	return rd.Status
+}
+
+// redirect sends the redirect response to location
+func (rd Redirect) redirect(w http.ResponseWriter, location string) {
+	w.Header().Set("Location", location)
+	w.WriteHeader(rd.status())
+}
+
+// location returns the URL the request has to be redirected to,
+// with the Params not given by the request or the URL itself
+func (rd Redirect) location(r *http.Request) string {
+	if !rd.PreserveQuery || r.URL.RawQuery == "" {
+		return addParams(rd.URL, rd.Params)
+	}
+
+	target, err := url.Parse(rd.URL)
+	if err != nil {
+		return rd.URL
+	}
+
+	if target.RawQuery == "" {
+		target.RawQuery = r.URL.RawQuery
+	} else {
+		target.RawQuery += "&" + r.URL.RawQuery
+	}
+
+	return addParams(target.String(), rd.Params)
+}
+
 // MapHandler will return an http.HandlerFunc (which also
 // implements http.Handler) that will attempt to map any
 // paths (keys in the map) to their corresponding URL (values
 // that each key in the map points to, in string format).
 // If the path is not provided in the map, then the fallback
 // http.Handler will be called instead.
-func MapHandler(pathsToUrls map[string]string, fallback http.Handler) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		if location, ok := pathsToUrls[r.URL.Path]; ok {
-			w.Header().Set("Location", location)
-			w.WriteHeader(302)
-		} else {
-			fallback.ServeHTTP(w, r)
-		}
+// The handler behaviour can be customized with opts.
+func MapHandler(pathsToUrls map[string]string, fallback http.Handler, opts ...Option) http.HandlerFunc {
+	o := newOptions(opts)
+
+	rt := &router{
+		exact: make(map[string]Redirect, len(pathsToUrls)),
+	}
+	for _, redirect := range o.normalization.mapRedirects(pathsToUrls) {
+		rt.exact[redirect.Path] = redirect
 	}
+
+	return routerHandler(rt, fallback, o)
 }
 
-// DataHandler will parse the provided data, in YAML or JSON format,
-// following format parameter, and then return
+// DataHandler will parse the provided data, in YAML, JSON, TOML or
+// CSV format following format parameter, and then return
 // an http.HandlerFunc (which also implements http.Handler)
 // that will attempt to map any paths to their corresponding
 // URL. If the path is not provided in the data file, then the
@@ -36,6 +130,11 @@ func MapHandler(pathsToUrls map[string]string, fallback http.Handler) http.Handl
 //
 //     - path: /some-path
 //       url: https://www.some-url.com/demo
+//     - path: /other-path
+//       url: https://www.some-url.com/other
+//       status: 301
+//       expires: 2030-01-01T00:00:00Z
+//       preserve_query: true
 //
 // JSON is expected to be in the format:
 //
@@ -43,31 +142,118 @@ func MapHandler(pathsToUrls map[string]string, fallback http.Handler) http.Handl
 //  	{
 //  		"path": "/some-path",
 //  		"url": "https://www.some-url.com/demo"
+//  	},
+//  	{
+//  		"path": "/other-path",
+//  		"url": "https://www.some-url.com/other",
+//  		"status": 301,
+//  		"expires": "2030-01-01T00:00:00Z",
+//  		"preserve_query": true
 //  	}
 //  ]
 //
-// The only errors that can be returned all related to having
-// invalid YAML or JSON data.
-func DataHandler(data []byte, format string, fallback http.Handler) (http.HandlerFunc, error) {
-	locations, err := parseData(data, format)
+// TOML is expected to be in the format:
+//
+//     [[redirect]]
+//     path = "/some-path"
+//     url = "https://www.some-url.com/demo"
+//
+// CSV is expected to have two columns, the path and the URL, with an
+// optional "path,url" header line.
+//
+// The status, expires, preserve_query, title, preview, password,
+// max_clicks, one_time, disabled and params fields are optional, see
+// Redirect for their meaning. They are not supported in CSV.
+// The params are a map of query parameters, like utm_campaign.
+//
+// Instead of an url, an entry can have a list of targets splitting
+// the visitors among them following their weights, 90% and 10% here:
+//
+//     - path: /signup
+//       targets:
+//         - name: current
+//           url: https://www.some-url.com/signup
+//           weight: 90
+//         - name: new
+//           url: https://www.some-url.com/signup-v2
+//           weight: 10
+//
+// Each visitor is kept on the same target by a cookie, and the clicks
+// of each target are counted apart, as <path>#<name>.
+//
+// An entry can send some of the visitors elsewhere with ordered rules
+// on their language, device or network, see Rule. The url, or the
+// targets, are the default for the visitors matching no rule:
+//
+//     - path: /app
+//       url: https://www.some-url.com/app
+//       rules:
+//         - devices: [ios]
+//           url: https://apps.apple.com/app/id123
+//         - devices: [android]
+//           url: https://play.google.com/store/apps/details?id=com.example
+//         - languages: [fr]
+//           url: https://www.some-url.com/fr/app
+//         - networks: [10.0.0.0/8]
+//           url: https://intranet.some-url.com/app
+//
+// Paths can contain named parameters, like /gh/:user/:repo, or end
+// with a wildcard, like /docs/*: the matching parts of the request
+// path are substituted to the :user, :repo or {rest} placeholders in
+// the URL. Exact paths take precedence over paths with parameters,
+// which take precedence over wildcards.
+//
+// The handler behaviour can be customized with opts.
+//
+// If the data is not in the expected format, or any of its entries is
+// invalid, a nil handler is returned along with an error naming the
+// offending entry. Every entry must have a path starting with '/',
+// an absolute URL and a supported status code, and no path can be
+// defined twice, even in a different form once normalized (see
+// NormalizePaths).
+func DataHandler(data []byte, format string, fallback http.Handler, opts ...Option) (http.HandlerFunc, error) {
+	o := newOptions(opts)
 
-	return func(w http.ResponseWriter, r *http.Request) {
-		requestURL := r.URL.Path
+	redirects, err := parseData(data, format)
+	if err != nil {
+		return nil, err
+	}
 
-		for url, path := range locations {
-			if requestURL == url {
-				w.Header().Set("Location", path)
-				w.WriteHeader(302)
-				return
-			}
+	redirects, err = o.normalization.redirects(redirects)
+	if err != nil {
+		return nil, err
+	}
+
+	redirects, err = o.chains.resolve(redirects, o.normalization)
+	if err != nil {
+		return nil, err
+	}
+
+	rt, err := newRouter(redirects)
+	if err != nil {
+		return nil, err
+	}
+
+	return routerHandler(rt, fallback, o), nil
+}
+
+// routerHandler returns an http.HandlerFunc redirecting the requests
+// matched by rt and passing the others to fallback
+func routerHandler(rt *router, fallback http.Handler, o *options) http.HandlerFunc {
+	rt.foldCase = o.normalization.FoldCase
+
+	lookup := func(path string) (Redirect, error) {
+		if redirect, ok := rt.lookup(path); ok {
+			return redirect, nil
 		}
+		return Redirect{}, ErrNotFound
+	}
 
-		fallback.ServeHTTP(w, r)
-	}, err
+	return o.handler(lookup, fallback, nil)
 }
 
-func parseData(data []byte, format string) (map[string]string, error) {
-	var parsedData []map[string]string
+func parseData(data []byte, format string) ([]Redirect, error) {
+	var parsedData []Redirect
 	var err error
 
 	switch format {
@@ -75,18 +261,103 @@ func parseData(data []byte, format string) (map[string]string, error) {
 		err = yaml.Unmarshal(data, &parsedData)
 	case "json":
 		err = json.Unmarshal(data, &parsedData)
+	case "toml":
+		parsedData, err = parseTOML(data)
+	case "csv":
+		parsedData, err = parseCSV(data)
 	default:
 		err = errors.New("unsupported data format")
 	}
 
 	if err != nil {
-		return map[string]string{}, err
+		return []Redirect{}, err
+	}
+
+	if err := validate(parsedData); err != nil {
+		return []Redirect{}, err
+	}
+
+	return parsedData, nil
+}
+
+// validate checks that every redirect is well formed and
+// that no path is defined twice, even with other parameter names
+func validate(redirects []Redirect) error {
+	seen := make(map[string]int, len(redirects))
+
+	for i, redirect := range redirects {
+		if err := redirect.validate(); err != nil {
+			return fmt.Errorf("entry #%d: %v", i+1, err)
+		}
+
+		key := routeKey(redirect.Path)
+		if j, ok := seen[key]; ok {
+			if redirects[j].Path != redirect.Path {
+				return fmt.Errorf("entry #%d: path %s matches the same requests as %s, entry #%d", i+1, redirect.Path, redirects[j].Path, j+1)
+			}
+			return fmt.Errorf("entry #%d: path %s already defined by entry #%d", i+1, redirect.Path, j+1)
+		}
+		seen[key] = i
+	}
+
+	return nil
+}
+
+func (rd Redirect) validate() error {
+	if rd.Path == "" {
+		return errors.New("missing path")
+	}
+
+	if !strings.HasPrefix(rd.Path, "/") {
+		return fmt.Errorf("path %s must start with '/'", rd.Path)
+	}
+
+	if err := validatePath(rd.Path); err != nil {
+		return err
+	}
+
+	if len(rd.Targets) > 0 {
+		if rd.URL != "" {
+			return fmt.Errorf("path %s has both an url and targets", rd.Path)
+		}
+		if err := rd.validateTargets(); err != nil {
+			return err
+		}
+	} else {
+		if rd.URL == "" {
+			return fmt.Errorf("missing url for path %s", rd.Path)
+		}
+
+		target, err := url.Parse(rd.URL)
+		if err != nil {
+			return fmt.Errorf("invalid url for path %s: %v", rd.Path, err)
+		}
+
+		if !target.IsAbs() || target.Host == "" {
+			return fmt.Errorf("url %s for path %s is not absolute", rd.URL, rd.Path)
+		}
+	}
+
+	switch rd.Status {
+	case 0, http.StatusMovedPermanently, http.StatusFound,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	default:
+		return fmt.Errorf("unsupported redirect status %d for path %s", rd.Status, rd.Path)
+	}
+
+	if rd.Password != "" {
+		if _, err := bcrypt.Cost([]byte(rd.Password)); err != nil {
+			return fmt.Errorf("password for path %s is not a valid hash: %v", rd.Path, err)
+		}
+	}
+
+	if rd.MaxClicks < 0 {
+		return fmt.Errorf("negative max_clicks for path %s", rd.Path)
 	}
 
-	locations := make(map[string]string)
-	for _, row := range parsedData {
-		locations[row["path"]] = row["url"]
+	if err := rd.validateRules(); err != nil {
+		return err
 	}
 
-	return locations, err
+	return nil
 }
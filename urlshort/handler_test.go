@@ -0,0 +1,144 @@
+package urlshort
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDataHandlerStatus(t *testing.T) {
+	data := `
+- path: /default
+  url: https://example.com/default
+- path: /permanent
+  url: https://example.com/permanent
+  status: 308
+`
+	h, err := DataHandler([]byte(data), "yaml", http.NotFoundHandler())
+	if err != nil {
+		t.Fatalf("DataHandler failed with error %v\n", err)
+	}
+
+	expected := map[string]int{
+		"/default":   http.StatusFound,
+		"/permanent": http.StatusPermanentRedirect,
+	}
+	for path, status := range expected {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+
+		if rec.Code != status {
+			t.Errorf("Expected status %v for %v, got %v\n", status, path, rec.Code)
+		}
+	}
+}
+
+func TestDataHandlerUnsupportedStatus(t *testing.T) {
+	data := `[{"path": "/a", "url": "https://example.com", "status": 200}]`
+
+	if _, err := DataHandler([]byte(data), "json", http.NotFoundHandler()); err == nil {
+		t.Errorf("Expected DataHandler to fail on status 200\n")
+	}
+}
+
+func TestRedirectExpired(t *testing.T) {
+	defer func() { now = time.Now }()
+	now = func() time.Time {
+		return time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+
+	data := `
+- path: /old
+  url: https://example.com/old
+  expires: 2019-12-31T23:59:59Z
+- path: /new
+  url: https://example.com/new
+  expires: 2020-01-01T00:00:01Z
+`
+	h, err := DataHandler([]byte(data), "yaml", http.NotFoundHandler())
+	if err != nil {
+		t.Fatalf("DataHandler failed with error %v\n", err)
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/old", nil))
+	if rec.Code != http.StatusGone {
+		t.Errorf("Expected status %v for expired link, got %v\n", http.StatusGone, rec.Code)
+	}
+
+	expectLocation(t, h, "/new", "https://example.com/new")
+}
+
+func TestRedirectPreserveQuery(t *testing.T) {
+	data := `
+- path: /plain
+  url: https://example.com/plain?a=1
+- path: /keep
+  url: https://example.com/keep?a=1
+  preserve_query: true
+- path: /keep-no-query
+  url: https://example.com/keep
+  preserve_query: true
+`
+	h, err := DataHandler([]byte(data), "yaml", http.NotFoundHandler())
+	if err != nil {
+		t.Fatalf("DataHandler failed with error %v\n", err)
+	}
+
+	expectLocation(t, h, "/plain?b=2", "https://example.com/plain?a=1")
+	expectLocation(t, h, "/keep?b=2", "https://example.com/keep?a=1&b=2")
+	expectLocation(t, h, "/keep-no-query?b=2", "https://example.com/keep?b=2")
+}
+
+func TestMapHandler(t *testing.T) {
+	h := MapHandler(map[string]string{
+		"/a":     "https://example.com/a",
+		"/b/:id": "https://example.com/b",
+	}, http.NotFoundHandler())
+
+	expectLocation(t, h, "/a", "https://example.com/a")
+	expectLocation(t, h, "/b/:id", "https://example.com/b")
+	expectLocation(t, h, "/b/1", "")
+}
+
+func TestDataHandlerInvalidData(t *testing.T) {
+	invalid := map[string]string{
+		"not json":      `[{"path": "/a"`,
+		"missing path":  `[{"url": "https://example.com"}]`,
+		"relative path": `[{"path": "a", "url": "https://example.com"}]`,
+		"missing url":   `[{"path": "/a"}]`,
+		"relative url":  `[{"path": "/a", "url": "example.com/a"}]`,
+		"duplicate path": `[
+			{"path": "/a", "url": "https://example.com/1"},
+			{"path": "/a", "url": "https://example.com/2"}
+		]`,
+	}
+
+	for name, data := range invalid {
+		h, err := DataHandler([]byte(data), "json", http.NotFoundHandler())
+		if err == nil {
+			t.Errorf("Expected DataHandler to fail with %v\n", name)
+		}
+		if h != nil {
+			t.Errorf("Expected nil handler with %v\n", name)
+		}
+	}
+}
+
+func TestDataHandlerErrorNamesEntry(t *testing.T) {
+	data := `
+- path: /a
+  url: https://example.com/a
+- path: /b
+`
+	_, err := DataHandler([]byte(data), "yaml", http.NotFoundHandler())
+	if err == nil {
+		t.Fatalf("Expected DataHandler to fail\n")
+	}
+
+	expected := "entry #2: missing url for path /b"
+	if err.Error() != expected {
+		t.Errorf("Expected error %q, got %q\n", expected, err.Error())
+	}
+}
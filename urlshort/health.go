@@ -0,0 +1,49 @@
+package urlshort
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+// Healthz is an http.HandlerFunc answering 200 OK as
+// long as the process is able to serve requests
+func Healthz(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintln(w, "ok")
+}
+
+// ReadyHandler will return an http.HandlerFunc (which also
+// implements http.Handler) running checks, keyed by name, on each
+// request: it answers 200 OK if all of them succeed, or 503 Service
+// Unavailable otherwise, listing the result of each check.
+// RedisStore.Ping is a typical check.
+func ReadyHandler(checks map[string]func() error) http.HandlerFunc {
+	names := make([]string, 0, len(checks))
+	for name := range checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		results := make([]string, len(names))
+		ready := true
+		for i, name := range names {
+			results[i] = name + ": ok"
+			if err := checks[name](); err != nil {
+				results[i] = fmt.Sprintf("%s: %v", name, err)
+				ready = false
+			}
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if !ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		for _, result := range results {
+			fmt.Fprintln(w, result)
+		}
+		if ready {
+			fmt.Fprintln(w, "ready")
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package urlshort
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// HostHandler will return an http.HandlerFunc (which also
+// implements http.Handler) that will pass each request to the
+// handler registered for its Host header (keys in the map, without
+// port), so that the same path can lead to different URLs on
+// different hosts. The handlers usually have their own redirect
+// tables and fallbacks.
+// If no handler is registered for the host, then the fallback
+// http.Handler will be called instead.
+func HostHandler(hosts map[string]http.Handler, fallback http.Handler) http.HandlerFunc {
+	handlers := make(map[string]http.Handler, len(hosts))
+	for host, h := range hosts {
+		handlers[NormalizeHost(host)] = h
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h, ok := handlers[NormalizeHost(r.Host)]; ok {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		fallback.ServeHTTP(w, r)
+	}
+}
+
+// NormalizeHost returns host in lower case,
+// without port and trailing dot
+func NormalizeHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
@@ -0,0 +1,42 @@
+package urlshort
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHostHandler(t *testing.T) {
+	fallback := MapHandler(map[string]string{
+		"/x": "https://default.example.com/x",
+		"/y": "https://default.example.com/y",
+	}, http.NotFoundHandler())
+
+	h := HostHandler(map[string]http.Handler{
+		"go.team-a.local": MapHandler(map[string]string{"/x": "https://a.example.com/x"}, fallback),
+		"GO.team-b.local": MapHandler(map[string]string{"/x": "https://b.example.com/x"}, fallback),
+	}, fallback)
+
+	tests := []struct {
+		host     string
+		path     string
+		expected string
+	}{
+		{"go.team-a.local", "/x", "https://a.example.com/x"},
+		{"go.team-b.local:8080", "/x", "https://b.example.com/x"},
+		{"Go.Team-A.local.", "/x", "https://a.example.com/x"},
+		{"go.team-a.local", "/y", "https://default.example.com/y"},
+		{"other.local", "/x", "https://default.example.com/x"},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", test.path, nil)
+		req.Host = test.host
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if location := rec.Header().Get("Location"); location != test.expected {
+			t.Errorf("Expected %v%v to redirect to %v, got %v\n", test.host, test.path, test.expected, location)
+		}
+	}
+}
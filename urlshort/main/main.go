@@ -4,84 +4,370 @@ import (
 	"flag"
 	"fmt"
 	"gophercises/urlshort"
-	"io/ioutil"
 	"log"
 	"net/http"
-	"strconv"
+	"net/url"
+	"os"
+	"strings"
+	"time"
 
-	"github.com/mediocregopher/radix.v2/redis"
+	"github.com/mediocregopher/radix.v2/pool"
+	bolt "go.etcd.io/bbolt"
 )
 
 func main() {
-	locationsFile := flag.String("locations", "redirects.yml", "input file name containing the redirects map")
-	format := flag.String("format", "yaml", "input file format (yaml|json)")
+	addr := flag.String("addr", ":8080", "address the server listens on")
+	readTimeout := flag.Duration("read-timeout", 5*time.Second, "maximum duration for reading a request")
+	writeTimeout := flag.Duration("write-timeout", 10*time.Second, "maximum duration for writing a response")
+	idleTimeout := flag.Duration("idle-timeout", 2*time.Minute, "how long idle keep-alive connections are kept open")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 10*time.Second, "how long the requests in flight are waited for on shutdown")
+	tlsCert := flag.String("tls-cert", "", "PEM file of the TLS certificate, serving HTTPS and HTTP/2 on -addr and -admin-addr")
+	tlsKey := flag.String("tls-key", "", "PEM file of the private key of -tls-cert")
+	tlsSelfSigned := flag.Bool("tls-self-signed", false, "serve HTTPS with a self-signed certificate for localhost and the local hosts, for development; it is written to -tls-cert and -tls-key if they are given and missing, and reused afterwards")
+	httpAddr := flag.String("http-addr", "", "address of a plain HTTP listener redirecting to HTTPS on -addr, like :80 (empty to disable)")
+	accessLog := flag.String("access-log", "-", "file the JSON access logs are appended to (- for stdout, empty to disable)")
+
+	locationsFiles := flag.String("locations", "redirects.yml", "comma separated list of input files containing the redirects map, in decreasing priority order (env:PREFIX reads the environment variables starting with PREFIX)")
+	format := flag.String("format", "", "input files format (yaml|json|toml|csv), detected from the file extension if omitted")
+	watch := flag.Duration("watch", 2*time.Second, "interval between checks for changes in the locations files (0 to disable)")
+
+	var redisOpts urlshort.RedisOptions
+	flag.StringVar(&redisOpts.Addr, "redis-addr", "localhost:6379", "address of the Redis server (empty to disable Redis)")
+	flag.StringVar(&redisOpts.Password, "redis-password", "", "password of the Redis server")
+	flag.IntVar(&redisOpts.DB, "redis-db", 0, "Redis database number")
+	flag.IntVar(&redisOpts.PoolSize, "redis-pool", 10, "number of connections kept open to Redis")
+	flag.DurationVar(&redisOpts.Timeout, "redis-timeout", time.Second, "timeout of the Redis commands")
+	redisKey := flag.String("redis-key", "urlshort", "key of the Redis hash containing the redirects map")
+	redisCache := flag.Duration("redis-cache", 10*time.Second, "how long the Redis lookups are cached (0 to disable)")
+
+	preview := flag.Bool("preview", false, "show a preview of the destination when a short path is followed by '+'")
+	denylist := flag.String("denylist", "", "comma separated list of domains for which a warning is shown instead of redirecting")
+	qrCodes := flag.Bool("qr", false, "serve the QR code of a short link when its path is followed by '.qr' or prefixed by '/qr'")
+	normalize := flag.String("normalize", "", "comma separated list of path normalizations: case (case insensitive), slash (ignore trailing slashes), collapse (collapse duplicate slashes), decode (percent-decode the paths of the redirects)")
+	baseURL := flag.String("base-url", "", "scheme and host of the short links, like https://go.example.com (the ones of each request if empty)")
+
+	rateLimit := flag.Float64("rate-limit", 0, "maximum redirects per second from each client (0 to disable)")
+	rateBurst := flag.Int("rate-burst", 20, "maximum burst of redirects from each client")
+	trustedProxies := flag.String("trusted-proxies", "", "comma separated list of IP addresses or CIDR ranges of the proxies whose X-Forwarded-For header is trusted")
+
+	boltPath := flag.String("bolt", "", "bbolt database containing redirects, looked up after Redis and before the locations files (empty to disable)")
+
+	adminAddr := flag.String("admin-addr", "", "address of the admin API, like localhost:8081 (empty to disable)")
+	adminToken := flag.String("admin-token", os.Getenv("URLSHORT_TOKEN"), "token required by the admin API (defaults to $URLSHORT_TOKEN)")
+	adminTokens := flag.String("admin-tokens", "", "comma separated list of name=token, tokens of the admin API besides -admin-token whose names are recorded as the authors of the changes in the audit log")
+	adminUser := flag.String("admin-user", "admin", "user name of the admin dashboard")
+	adminPassword := flag.String("admin-password", "", "password of the admin dashboard (the admin token if empty)")
+	auditLog := flag.String("audit-log", "", "file of the audit log recording the changes made through the admin API and dashboard, served at /history/ (empty to disable)")
+	adminRateLimit := flag.Float64("admin-rate-limit", 5, "maximum admin API requests per second from each client (0 to disable)")
+	adminRateBurst := flag.Int("admin-rate-burst", 20, "maximum burst of admin API requests from each client")
+
+	checkInterval := flag.Duration("check-interval", 0, "interval between checks of the targets of the redirects, reported by the admin API at /checks (0 to disable); only the ones of the default namespace are checked, not the ones of the -host namespaces")
+	checkTimeout := flag.Duration("check-timeout", 10*time.Second, "timeout of the requests checking a target")
+
+	localHosts := flag.String("local-hosts", "", "comma separated list of the hosts of the short links, besides the one of -base-url: targets on them are followed to detect loops")
+	collapseChains := flag.Bool("collapse-chains", false, "replace the targets leading to other short links with their final destination")
+
+	hosts := make(hostsFlag)
+	flag.Var(hosts, "host", "host with its own redirects, as host=comma separated list of locations files; their Redis hash is the one of -redis-key followed by ':host' (can be repeated)")
+
+	params := flag.String("params", "", "query parameters added to the targets of the redirects, like utm_source=short&utm_medium=link, unless they already have them")
+	hostParams := make(hostsFlag)
+	flag.Var(hostParams, "host-params", "query parameters added to the targets of the redirects of a host, as host=utm_source=short&utm_medium=link, instead of -params (can be repeated)")
 	flag.Parse()
 
-	locations, err := ioutil.ReadFile(*locationsFile)
+	normalization, err := urlshort.ParseNormalization(*normalize)
 	if err != nil {
 		log.Fatal(err)
 	}
+	proxies, err := urlshort.ParseTrustedProxies(strings.Split(*trustedProxies, ","))
+	if err != nil {
+		log.Fatal(err)
+	}
+	opts := []urlshort.Option{urlshort.NormalizePaths(normalization), urlshort.TrustProxies(proxies)}
+	if *preview {
+		opts = append(opts, urlshort.Preview())
+	}
+	if *denylist != "" {
+		opts = append(opts, urlshort.Denylist(strings.Split(*denylist, ",")))
+	}
+	if *qrCodes {
+		opts = append(opts, urlshort.QRCodes(*baseURL))
+	}
 
-	if *format != "yaml" && *format != "json" {
-		log.Fatalf("unsupported input file format: %s\n", *format)
+	var redisPool *pool.Pool
+	if redisOpts.Addr != "" {
+		redisPool = newRedisPool(redisOpts)
 	}
 
-	mux := defaultMux()
+	var boltDB *bolt.DB
+	if *boltPath != "" {
+		var err error
+		boltDB, err = bolt.Open(*boltPath, 0644, &bolt.Options{Timeout: time.Second})
+		if err != nil {
+			log.Fatalf("cannot open %s: %v", *boltPath, err)
+		}
+		defer boltDB.Close()
+	}
 
-	pathsToUrls, err := getLocationsMap()
-	if err != nil {
-		panic(err)
+	if u, err := url.Parse(*baseURL); err == nil && u.Host != "" {
+		*localHosts += "," + u.Host
+	}
+
+	defaultParams := make(map[string]map[string]string)
+	if defaultParams[""], err = urlshort.ParseParams(*params); err != nil {
+		log.Fatalf("invalid -params: %v", err)
+	}
+	for host, query := range hostParams {
+		if defaultParams[urlshort.NormalizeHost(host)], err = urlshort.ParseParams(query); err != nil {
+			log.Fatalf("invalid -host-params for %s: %v", host, err)
+		}
 	}
 
-	// Build the defaultHandler using the mux as the fallback
-	defaultHandler := urlshort.MapHandler(pathsToUrls, mux)
+	rs := &redirects{
+		format:     *format,
+		watch:      *watch,
+		redisPool:  redisPool,
+		redisKey:   *redisKey,
+		redisCache: *redisCache,
+		boltDB:     boltDB,
+		metrics:    urlshort.NewMetrics(),
+		localHosts: splitList(*localHosts),
+		collapse:   *collapseChains,
+		normalize:  normalization,
+		params:     defaultParams,
+		qrCodes:    *qrCodes,
+		opts:       opts,
+	}
 
-	// Build the YAMLHandler using the defaultHandler as the fallback
-	handler, err := urlshort.DataHandler(locations, *format, defaultHandler)
-	if err != nil {
-		panic(err)
+	// Build the default handler using the mux as the fallback
+	defaultNamespace := rs.handler("", *locationsFiles, defaultMux())
+	var handler http.Handler = defaultNamespace
+
+	// Build the handlers of the hosts with their own redirects,
+	// using the default handler as the fallback
+	if len(hosts) > 0 {
+		hostHandlers := make(map[string]http.Handler)
+		for host, locations := range hosts {
+			hostHandlers[host] = rs.handler(urlshort.NormalizeHost(host), locations, handler)
+		}
+		handler = urlshort.HostHandler(hostHandlers, handler)
 	}
 
-	log.Println("Starting the server on :8080")
-	http.ListenAndServe(":8080", handler)
-}
+	handler = rs.metrics.Handler(handler)
 
-func defaultMux() *http.ServeMux {
-	mux := http.NewServeMux()
-	mux.HandleFunc("/", hello)
-	return mux
-}
+	if *rateLimit > 0 {
+		limiter, err := urlshort.NewRateLimiter(*rateLimit, *rateBurst, strings.Split(*trustedProxies, ","))
+		if err != nil {
+			log.Fatal(err)
+		}
+		handler = limiter.Handler(handler)
+	}
 
-func hello(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprintf(w, "No mapping defined for this handler :(")
+	if *accessLog != "" {
+		out := os.Stdout
+		if *accessLog != "-" {
+			var err error
+			out, err = os.OpenFile(*accessLog, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer out.Close()
+		}
+		handler = urlshort.AccessLog(out, handler)
+	}
+
+	// Serve the health and metrics endpoints before the
+	// redirects, keeping them out of the access logs
+	checks := make(map[string]func() error)
+	if redisPool != nil {
+		checks["redis"] = urlshort.NewRedisStore(redisPool, *redisKey).Ping
+	}
+	handler = opsHandler(map[string]http.Handler{
+		"/healthz": http.HandlerFunc(urlshort.Healthz),
+		"/readyz":  urlshort.ReadyHandler(checks),
+		"/metrics": rs.metrics,
+	}, handler)
+
+	var checker *urlshort.Checker
+	if *checkInterval > 0 {
+		// the results have no host, so only the default namespace
+		checker = urlshort.NewChecker(*checkTimeout, 8)
+		go checker.Run(*checkInterval, defaultNamespace.redirects, nil, func(err error) {
+			log.Printf("cannot list the redirects to check: %v\n", err)
+		}, func(result urlshort.CheckResult) {
+			log.Printf("broken link %s -> %s: %s\n", result.Path, result.URL, describe(result))
+		})
+	}
+
+	var servers []*server
+	if *adminAddr != "" {
+		tokens := make(map[string]string)
+		if *adminToken != "" {
+			tokens["token"] = *adminToken
+		}
+		for _, entry := range splitList(*adminTokens) {
+			parts := strings.SplitN(entry, "=", 2)
+			if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+				log.Fatalf("invalid -admin-tokens entry %q, expected name=token", entry)
+			}
+			tokens[parts[0]] = parts[1]
+		}
+		if len(tokens) == 0 {
+			log.Fatal("-admin-token or -admin-tokens is required by the admin API")
+		}
+
+		store, onChange, err := defaultNamespace.adminStore(*locationsFiles, *format)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if *auditLog != "" {
+			l, err := urlshort.OpenAuditLog(*auditLog)
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer l.Close()
+			store = urlshort.Audit(store, l, "").Normalizing(defaultNamespace.normalize)
+		}
+
+		api := http.NewServeMux()
+		api.Handle("/links", urlshort.AdminHandler(store, defaultNamespace.counter, onChange))
+		api.Handle("/links/", urlshort.AdminHandler(store, defaultNamespace.counter, onChange))
+		api.Handle("/history/", urlshort.AdminHandler(store, defaultNamespace.counter, onChange))
+		if checker != nil {
+			api.Handle("/checks", checker)
+		}
+
+		if *adminPassword == "" {
+			*adminPassword = *adminToken
+		}
+		if *adminPassword == "" {
+			log.Fatal("-admin-password is required by the admin dashboard without -admin-token")
+		}
+
+		// the API is used by scripts, the dashboard by browsers
+		authenticatedAPI := urlshort.RequireTokens(tokens, api)
+		mux := http.NewServeMux()
+		mux.Handle("/links", authenticatedAPI)
+		mux.Handle("/links/", authenticatedAPI)
+		mux.Handle("/history/", authenticatedAPI)
+		mux.Handle("/checks", authenticatedAPI)
+		mux.Handle("/", urlshort.BasicAuth(*adminUser, *adminPassword,
+			urlshort.Dashboard(store, defaultNamespace.counter, onChange)))
+
+		var admin http.Handler = mux
+		if *adminRateLimit > 0 {
+			limiter, err := urlshort.NewRateLimiter(*adminRateLimit, *adminRateBurst, strings.Split(*trustedProxies, ","))
+			if err != nil {
+				log.Fatal(err)
+			}
+			admin = limiter.Handler(admin)
+		}
+
+		servers = append(servers, newServer("admin API", *adminAddr, admin))
+	}
+
+	servers = append(servers, newServer("server", *addr, handler))
+
+	if *tlsCert != "" || *tlsKey != "" || *tlsSelfSigned {
+		if !*tlsSelfSigned && (*tlsCert == "" || *tlsKey == "") {
+			log.Fatal("-tls-cert and -tls-key are both required for TLS")
+		}
+
+		names := splitList(*localHosts)
+		for host := range hosts {
+			names = append(names, host)
+		}
+		config, err := tlsConfig(*tlsCert, *tlsKey, *tlsSelfSigned, names)
+		if err != nil {
+			log.Fatalf("cannot load the TLS certificate: %v", err)
+		}
+		for _, srv := range servers {
+			srv.TLSConfig = config
+		}
+
+		if *httpAddr != "" {
+			servers = append(servers, newServer("HTTPS redirect", *httpAddr, redirectHTTPS(*addr)))
+		}
+	} else if *httpAddr != "" {
+		log.Fatal("-http-addr requires -tls-cert and -tls-key or -tls-self-signed")
+	}
+
+	for _, srv := range servers {
+		srv.ReadTimeout = *readTimeout
+		srv.WriteTimeout = *writeTimeout
+		srv.IdleTimeout = *idleTimeout
+	}
+
+	if err := serve(servers, *shutdownTimeout); err != nil {
+		log.Fatal(err)
+	}
 }
 
-func getLocationsMap() (map[string]string, error) {
-	client, err := redis.Dial("tcp", "localhost:6379")
-	if err != nil {
-		return nil, err
+// hostsFlag collects repeated host=value flags, like the -host
+// ones mapping each host to its list of locations files
+type hostsFlag map[string]string
+
+func (h hostsFlag) String() string {
+	var hosts []string
+	for host, locations := range h {
+		hosts = append(hosts, host+"="+locations)
 	}
-	defer client.Close()
+	return strings.Join(hosts, " ")
+}
 
-	resp := client.Cmd("LLEN", "urlshort")
-	if resp.Err != nil {
-		return nil, resp.Err
+func (h hostsFlag) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if parts[0] == "" {
+		return fmt.Errorf("missing host in %q", value)
 	}
 
-	l, err := resp.Int()
-	if err != nil {
-		return nil, err
+	if len(parts) == 1 {
+		// only the redirects in Redis
+		parts = append(parts, "")
 	}
 
-	resp = client.Cmd("LRANGE", "urlshort", "0", strconv.Itoa(l))
-	if resp.Err != nil {
-		return nil, resp.Err
+	h[parts[0]] = parts[1]
+	return nil
+}
+
+// splitList returns the non empty items of
+// the comma separated list s
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
 	}
+	return items
+}
 
-	pathsToUrls, err := resp.Map()
-	if err != nil {
-		return nil, err
+func describe(result urlshort.CheckResult) string {
+	if result.Error != "" {
+		return result.Error
 	}
+	return http.StatusText(result.Status)
+}
 
-	return pathsToUrls, nil
+// opsHandler passes the requests for the paths of ops to
+// their handlers, and all the other ones to h
+func opsHandler(ops map[string]http.Handler, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if op, ok := ops[r.URL.Path]; ok {
+			op.ServeHTTP(w, r)
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+func defaultMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", hello)
+	return mux
+}
+
+func hello(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintf(w, "No mapping defined for this handler :(")
 }
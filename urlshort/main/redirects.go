@@ -0,0 +1,277 @@
+package main
+
+import (
+	"fmt"
+	"gophercises/urlshort"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/mediocregopher/radix.v2/pool"
+	bolt "go.etcd.io/bbolt"
+)
+
+// redirects holds the settings shared by the
+// handlers serving the redirects of each host
+type redirects struct {
+	format     string
+	watch      time.Duration
+	redisPool  *pool.Pool
+	redisKey   string
+	redisCache time.Duration
+	boltDB     *bolt.DB
+	metrics    *urlshort.Metrics
+	localHosts []string // of the default namespace
+	collapse   bool
+	normalize  urlshort.Normalization
+	params     map[string]map[string]string // by namespace
+	qrCodes    bool
+	opts       []urlshort.Option
+}
+
+// namespace is the handler serving the redirects of a host,
+// along with the stores behind it
+type namespace struct {
+	http.Handler
+	files     *urlshort.FileHandler
+	cache     *urlshort.CachedStore
+	store     urlshort.WritableStore // the first store looked up, nil if only files
+	counter   urlshort.Counter
+	chains    urlshort.Chains
+	normalize urlshort.Normalization
+}
+
+// handler builds the handler serving the redirects of namespace,
+// empty for the default one: they are looked up in Redis, if
+// enabled, then in the bbolt database, if enabled, then in the
+// locations files and finally passed to fallback. The files are
+// reloaded when they change.
+func (rs *redirects) handler(name, locations string, fallback http.Handler) *namespace {
+	var sources []urlshort.Source
+	for _, s := range strings.Split(locations, ",") {
+		if s != "" {
+			sources = append(sources, urlshort.ParseSource(s, rs.format))
+		}
+	}
+
+	key := rs.redisKey
+	if name != "" {
+		key += ":" + name
+	}
+
+	ns := &namespace{normalize: rs.normalize}
+
+	// Keep the clicks in Redis or in the bbolt database,
+	// if enabled, so that they survive the restarts
+	var redisStore *urlshort.RedisStore
+	var boltStore *urlshort.BoltStore
+	if rs.boltDB != nil {
+		var err error
+		if boltStore, err = urlshort.NewBoltStore(rs.boltDB, key); err != nil {
+			log.Fatal(err)
+		}
+		ns.store, ns.counter = boltStore, boltStore
+	}
+	if rs.redisPool != nil {
+		redisStore = urlshort.NewRedisStore(rs.redisPool, key)
+		ns.store, ns.counter = redisStore, redisStore
+	}
+	if ns.counter == nil {
+		ns.counter = urlshort.NewMemoryCounter()
+	}
+
+	ns.chains = urlshort.Chains{Hosts: rs.localHosts, Collapse: rs.collapse}
+	if name != "" {
+		ns.chains.Hosts = []string{name}
+	}
+
+	opts := append([]urlshort.Option{}, rs.opts...)
+	if rs.qrCodes && name != "" {
+		// the short links of the namespace are on the
+		// host of the requests, not on the base URL
+		opts = append(opts, urlshort.QRCodes(""))
+	}
+	opts = append(opts, urlshort.Clicks(ns.counter), urlshort.ResolveChains(ns.chains))
+	if params, ok := rs.params[name]; ok {
+		opts = append(opts, urlshort.DefaultParams(params))
+	} else {
+		opts = append(opts, urlshort.DefaultParams(rs.params[""]))
+	}
+
+	// observed returns opts recording the lookups on store
+	observed := func(store string) []urlshort.Option {
+		return append(opts[:len(opts):len(opts)], urlshort.Observe(rs.metrics, store))
+	}
+
+	// Build the file based handler using fallback as the fallback
+	fileHandler, err := urlshort.NewSourcesHandler(sources, fallback, observed("files")...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	logConflicts(name, fileHandler)
+	if _, ok := ns.counter.(*urlshort.MemoryCounter); ok {
+		warnLimitedLinks(name, fileHandler.Redirects())
+	}
+
+	reloadOnChange(name, fileHandler, rs.watch)
+	ns.files = fileHandler
+	ns.Handler = fileHandler
+
+	// Build the bbolt handler using the file based handler as the fallback
+	if boltStore != nil {
+		ns.Handler = urlshort.StoreHandler(boltStore, ns.Handler, func(err error) {
+			log.Printf("%sbbolt lookup failed: %v\n", logPrefix(name), err)
+		}, observed("bolt")...)
+	}
+
+	if redisStore == nil {
+		return ns
+	}
+
+	// Build the Redis handler using the previous handler as the
+	// fallback, so it is used when Redis is unreachable
+	var store urlshort.Store = redisStore
+	if rs.redisCache > 0 {
+		ns.cache = urlshort.NewCachedStore(store, rs.redisCache, 1000)
+		store = ns.cache
+	}
+
+	ns.Handler = urlshort.StoreHandler(store, ns.Handler, func(err error) {
+		// log only the first error, until Redis is back
+		if err != urlshort.ErrUnavailable {
+			log.Printf("Redis lookup failed, using only the other stores for a while: %v\n", err)
+		}
+	}, observed("redis")...)
+
+	return ns
+}
+
+// redirects returns all the redirects of ns, the ones in its store
+// first, followed by the ones in the files not shadowed by them
+func (ns *namespace) redirects() ([]urlshort.Redirect, error) {
+	var redirects []urlshort.Redirect
+	if ns.store != nil {
+		var err error
+		if redirects, err = ns.store.List(); err != nil {
+			return nil, err
+		}
+	}
+
+	defined := make(map[string]bool, len(redirects))
+	for _, redirect := range redirects {
+		defined[ns.normalize.Key(redirect.Path)] = true
+	}
+
+	for _, redirect := range ns.files.Redirects() {
+		if !defined[ns.normalize.Key(redirect.Path)] {
+			redirects = append(redirects, redirect)
+		}
+	}
+
+	return redirects, nil
+}
+
+// adminStore returns the store managed by the admin API, the first
+// one looked up by ns or, if there are none, the first locations
+// file, and a function to call when its redirects change.
+func (ns *namespace) adminStore(locations, format string) (urlshort.WritableStore, func(string), error) {
+	onChange := func(path string) {
+		if ns.cache != nil {
+			ns.cache.Forget(path)
+			ns.cache.Forget(ns.normalize.Path(path))
+		}
+	}
+
+	// the paths are normalized before the chains are resolved, and
+	// the patterns refused since the stores only match exact paths
+	if ns.store != nil {
+		return urlshort.ExactPaths(urlshort.NormalizeStore(urlshort.ChainGuard(ns.store, ns.chains, ns.normalize, ns.redirects), ns.normalize)), onChange, nil
+	}
+
+	for _, s := range strings.Split(locations, ",") {
+		source := urlshort.ParseSource(s, format)
+		if source.Path == "" || source.Format == "env" {
+			continue
+		}
+
+		store, err := urlshort.NewFileStore(source.Path, source.Format)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return urlshort.NormalizeStore(urlshort.ChainGuard(store, ns.chains, ns.normalize, ns.redirects), ns.normalize), func(string) {
+			if err := ns.files.Reload(); err != nil {
+				log.Printf("cannot reload locations, keeping the previous ones: %v\n", err)
+			}
+		}, nil
+	}
+
+	return nil, nil, fmt.Errorf("no store to manage: enable Redis or bbolt, or set a locations file")
+}
+
+// reloadOnChange reloads the locations files each time the process
+// receives a SIGHUP and, if interval is positive, whenever a file
+// is modified. If a new file is invalid the error is logged and
+// the previous redirects are kept.
+func reloadOnChange(namespace string, handler *urlshort.FileHandler, interval time.Duration) {
+	logError := func(err error) {
+		log.Printf("%scannot reload locations, keeping the previous ones: %v\n", logPrefix(namespace), err)
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if err := handler.Reload(); err != nil {
+				logError(err)
+				continue
+			}
+			log.Printf("%slocations reloaded\n", logPrefix(namespace))
+			logConflicts(namespace, handler)
+		}
+	}()
+
+	if interval > 0 {
+		go handler.Watch(interval, nil, logError)
+	}
+}
+
+func logConflicts(namespace string, handler *urlshort.FileHandler) {
+	for _, conflict := range handler.Conflicts() {
+		log.Printf("%sconflict: %v\n", logPrefix(namespace), conflict)
+	}
+}
+
+// warnLimitedLinks warns about the links followed a limited number
+// of times among redirects, whose clicks are only kept in memory
+func warnLimitedLinks(namespace string, redirects []urlshort.Redirect) {
+	for _, redirect := range redirects {
+		if redirect.OneTime || redirect.MaxClicks > 0 {
+			log.Printf("%swarning: the clicks are kept in memory, %s and the other links followed a limited number of times can be followed again after a restart: enable Redis or bbolt to keep them\n", logPrefix(namespace), redirect.Path)
+			return
+		}
+	}
+}
+
+func logPrefix(namespace string) string {
+	if namespace == "" {
+		return ""
+	}
+	return namespace + ": "
+}
+
+// newRedisPool returns a pool of connections to Redis.
+// If Redis can't be reached the error is just logged, since the
+// pool will connect as soon as it is back.
+func newRedisPool(opts urlshort.RedisOptions) *pool.Pool {
+	p, err := urlshort.NewRedisPool(opts)
+	if err != nil {
+		log.Printf("cannot connect to Redis at %s, using only the locations files until it is back: %v\n", opts.Addr, err)
+	}
+
+	return p
+}
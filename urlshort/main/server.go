@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// server is an http.Server with a name used in the logs
+type server struct {
+	*http.Server
+	name string
+}
+
+func newServer(name, addr string, handler http.Handler) *server {
+	return &server{
+		Server: &http.Server{Addr: addr, Handler: handler},
+		name:   name,
+	}
+}
+
+// serve runs servers until the process receives SIGINT or SIGTERM,
+// or one of them fails, then shuts them all down waiting up to
+// timeout for the requests in flight to complete.
+func serve(servers []*server, timeout time.Duration) error {
+	errs := make(chan error, len(servers))
+	for _, srv := range servers {
+		go func(srv *server) {
+			log.Printf("Starting the %s on %s\n", srv.name, srv.Addr)
+			var err error
+			if srv.TLSConfig != nil {
+				err = srv.ListenAndServeTLS("", "")
+			} else {
+				err = srv.ListenAndServe()
+			}
+			if err != http.ErrServerClosed {
+				errs <- fmt.Errorf("%s: %v", srv.name, err)
+			}
+		}(srv)
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(stop)
+
+	var err error
+	select {
+	case sig := <-stop:
+		log.Printf("Received %v, shutting down\n", sig)
+	case err = <-errs:
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	for _, srv := range servers {
+		if shutdownErr := srv.Shutdown(ctx); shutdownErr != nil {
+			log.Printf("%s: requests still in flight dropped: %v\n", srv.name, shutdownErr)
+		}
+	}
+
+	return err
+}
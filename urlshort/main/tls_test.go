@@ -0,0 +1,54 @@
+package main
+
+import (
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRedirectHTTPS(t *testing.T) {
+	for _, test := range []struct {
+		tlsAddr, method, host, target string
+		status                        int
+		location                      string
+	}{
+		{":443", http.MethodGet, "go.example.com", "/a?x=1", http.StatusMovedPermanently, "https://go.example.com/a?x=1"},
+		{":443", http.MethodGet, "go.example.com:80", "/a", http.StatusMovedPermanently, "https://go.example.com/a"},
+		{":8443", http.MethodHead, "localhost:8080", "/a", http.StatusMovedPermanently, "https://localhost:8443/a"},
+		{"127.0.0.1:8443", http.MethodGet, "[::1]:8080", "/", http.StatusMovedPermanently, "https://[::1]:8443/"},
+		{":443", http.MethodPost, "go.example.com", "/a", http.StatusPermanentRedirect, "https://go.example.com/a"},
+		{":8443", http.MethodPut, "go.example.com", "/a", http.StatusPermanentRedirect, "https://go.example.com:8443/a"},
+	} {
+		r := httptest.NewRequest(test.method, test.target, nil)
+		r.Host = test.host
+
+		w := httptest.NewRecorder()
+		redirectHTTPS(test.tlsAddr).ServeHTTP(w, r)
+		if w.Code != test.status || w.Header().Get("Location") != test.location {
+			t.Errorf("Expected %+v to be redirected with status %d to %s, got %d to %s\n",
+				test, test.status, test.location, w.Code, w.Header().Get("Location"))
+		}
+	}
+}
+
+func TestSelfSignedCertificate(t *testing.T) {
+	cert, err := selfSignedCertificate([]string{"go.example.com", "192.0.2.1:8443"}, "", "")
+	if err != nil {
+		t.Fatalf("selfSignedCertificate failed with error %v\n", err)
+	}
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("ParseCertificate failed with error %v\n", err)
+	}
+
+	if leaf.IsCA || leaf.KeyUsage&x509.KeyUsageCertSign != 0 {
+		t.Errorf("Expected a leaf certificate, unable to sign others\n")
+	}
+	for _, host := range []string{"localhost", "go.example.com", "127.0.0.1", "192.0.2.1"} {
+		if err := leaf.VerifyHostname(host); err != nil {
+			t.Errorf("Expected the certificate to be valid for %s, got %v\n", host, err)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package urlshort
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Outcomes of the requests counted by Metrics
+const (
+	OutcomeRedirect = "redirect"  // the request was redirected by a link
+	OutcomePage     = "page"      // a link served a page instead, like its preview or QR code
+	OutcomeLocked   = "locked"    // a link asked for its password
+	OutcomeGone     = "gone"      // a link was disabled, expired or used up
+	OutcomeError    = "error"     // a link could not be served
+	OutcomeFallback = "fallback"  // the fallback handler served it
+	OutcomeNotFound = "not_found" // the fallback handler answered 404
+)
+
+var (
+	requestBuckets = []float64{.0005, .001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5}
+	lookupBuckets  = []float64{.00001, .00005, .0001, .0005, .001, .005, .01, .05, .1, .5, 1}
+)
+
+// Metrics collects the metrics of the handlers and exposes
+// them in the Prometheus text format:
+//
+//	urlshort_requests_total{outcome}                  requests by outcome
+//	urlshort_request_duration_seconds                 histogram of the request latencies
+//	urlshort_lookup_duration_seconds{store}           histogram of the lookup latencies
+//	urlshort_store_errors_total{store}                failed lookups
+type Metrics struct {
+	mu          sync.Mutex
+	requests    map[string]uint64
+	durations   *histogram
+	lookups     map[string]*histogram
+	storeErrors map[string]uint64
+}
+
+// NewMetrics returns an empty Metrics
+func NewMetrics() *Metrics {
+	return &Metrics{
+		requests: map[string]uint64{
+			OutcomeRedirect: 0,
+			OutcomePage:     0,
+			OutcomeLocked:   0,
+			OutcomeGone:     0,
+			OutcomeError:    0,
+			OutcomeFallback: 0,
+			OutcomeNotFound: 0,
+		},
+		durations:   newHistogram(requestBuckets),
+		lookups:     make(map[string]*histogram),
+		storeErrors: make(map[string]uint64),
+	}
+}
+
+// Observe makes the handlers record in m the latency and the errors
+// of their lookups, labelled with the name of their store.
+func Observe(m *Metrics, store string) Option {
+	return func(o *options) {
+		o.metrics = m
+		o.store = store
+	}
+}
+
+// Handler returns an http.Handler passing the requests to h
+// and recording their outcome and latency.
+func (m *Metrics) Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := now()
+
+		r, info := withRequestInfo(r)
+		sw := &statusWriter{ResponseWriter: w}
+		h.ServeHTTP(sw, r)
+
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		m.requests[outcome(info.rule != "", sw.status)]++
+		m.durations.observe(now().Sub(start).Seconds())
+	})
+}
+
+// outcome returns the outcome of a request answered with status,
+// after matching a link or not
+func outcome(matched bool, status int) string {
+	switch {
+	case !matched && status == http.StatusNotFound:
+		return OutcomeNotFound
+	case !matched:
+		return OutcomeFallback
+	case status >= 300 && status < 400:
+		return OutcomeRedirect
+	case status == http.StatusGone:
+		return OutcomeGone
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return OutcomeLocked
+	case status >= 500:
+		return OutcomeError
+	}
+	return OutcomePage
+}
+
+// observeLookup records a lookup on store taking d
+func (m *Metrics) observeLookup(store string, d time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	h, ok := m.lookups[store]
+	if !ok {
+		h = newHistogram(lookupBuckets)
+		m.lookups[store] = h
+		m.storeErrors[store] = 0
+	}
+	h.observe(d.Seconds())
+
+	if err != nil && err != ErrNotFound {
+		m.storeErrors[store]++
+	}
+}
+
+// ServeHTTP serves the metrics in the Prometheus text format
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
+
+// WriteTo writes the metrics to w in the Prometheus text format
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cw := &countingWriter{w: w}
+
+	fmt.Fprintln(cw, "# HELP urlshort_requests_total Requests served, by outcome.")
+	fmt.Fprintln(cw, "# TYPE urlshort_requests_total counter")
+	for _, outcome := range sortedKeys(m.requests) {
+		fmt.Fprintf(cw, "urlshort_requests_total{outcome=%q} %d\n", outcome, m.requests[outcome])
+	}
+
+	fmt.Fprintln(cw, "# HELP urlshort_request_duration_seconds Latency of the requests.")
+	fmt.Fprintln(cw, "# TYPE urlshort_request_duration_seconds histogram")
+	m.durations.write(cw, "urlshort_request_duration_seconds", "")
+
+	stores := sortedKeys(m.storeErrors)
+
+	fmt.Fprintln(cw, "# HELP urlshort_lookup_duration_seconds Latency of the lookups, by store.")
+	fmt.Fprintln(cw, "# TYPE urlshort_lookup_duration_seconds histogram")
+	for _, store := range stores {
+		m.lookups[store].write(cw, "urlshort_lookup_duration_seconds", fmt.Sprintf("store=%q", store))
+	}
+
+	fmt.Fprintln(cw, "# HELP urlshort_store_errors_total Failed lookups, by store.")
+	fmt.Fprintln(cw, "# TYPE urlshort_store_errors_total counter")
+	for _, store := range stores {
+		fmt.Fprintf(cw, "urlshort_store_errors_total{store=%q} %d\n", store, m.storeErrors[store])
+	}
+
+	return cw.n, cw.err
+}
+
+// histogram counts the observations falling
+// in each bucket, by upper bound
+type histogram struct {
+	bounds []float64
+	counts []uint64 // not cumulative
+	sum    float64
+	count  uint64
+}
+
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{
+		bounds: bounds,
+		counts: make([]uint64, len(bounds)),
+	}
+}
+
+func (h *histogram) observe(v float64) {
+	i := sort.SearchFloat64s(h.bounds, v)
+	if i < len(h.bounds) {
+		h.counts[i]++
+	}
+	h.sum += v
+	h.count++
+}
+
+// write writes the series of the histogram, with labels
+// added to the ones of each series if not empty
+func (h *histogram) write(w io.Writer, name, labels string) {
+	if labels != "" {
+		labels += ","
+	}
+
+	var cumulative uint64
+	for i, bound := range h.bounds {
+		cumulative += h.counts[i]
+		le := strconv.FormatFloat(bound, 'g', -1, 64)
+		fmt.Fprintf(w, "%s_bucket{%sle=%q} %d\n", name, labels, le, cumulative)
+	}
+	fmt.Fprintf(w, "%s_bucket{%sle=\"+Inf\"} %d\n", name, labels, h.count)
+
+	labels = trimLabels(labels)
+	fmt.Fprintf(w, "%s_sum%s %s\n", name, labels, strconv.FormatFloat(h.sum, 'g', -1, 64))
+	fmt.Fprintf(w, "%s_count%s %d\n", name, labels, h.count)
+}
+
+// trimLabels turns the labels prefix used for
+// the buckets into the labels of the other series
+func trimLabels(labels string) string {
+	if labels == "" {
+		return ""
+	}
+	return "{" + labels[:len(labels)-1] + "}"
+}
+
+func sortedKeys(m map[string]uint64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (cw *countingWriter) Write(b []byte) (int, error) {
+	if cw.err != nil {
+		return 0, cw.err
+	}
+	n, err := cw.w.Write(b)
+	cw.n += int64(n)
+	cw.err = err
+	return n, err
+}
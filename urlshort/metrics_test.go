@@ -0,0 +1,85 @@
+package urlshort
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	m := NewMetrics()
+
+	redirects := []byte(`[
+		{"path": "/a", "url": "https://example.com/a"},
+		{"path": "/off", "url": "https://example.com/off", "disabled": true},
+		{"path": "/p", "url": "https://example.com/p", "preview": true}
+	]`)
+	notFound, err := DataHandler(redirects, "json", http.NotFoundHandler(), Observe(m, "files"))
+	if err != nil {
+		t.Fatalf("DataHandler failed with error %v\n", err)
+	}
+
+	broken := StoreHandler(storeFunc(func(path string) (Redirect, error) {
+		return Redirect{}, errors.New("connection refused")
+	}), notFound, nil, Observe(m, "redis"))
+	h := m.Handler(broken)
+
+	for _, path := range []string{"/a", "/a", "/missing", "/off", "/p"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	fallback := m.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	fallback.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+
+	for _, expected := range []string{
+		`urlshort_requests_total{outcome="redirect"} 2`,
+		`urlshort_requests_total{outcome="not_found"} 1`,
+		`urlshort_requests_total{outcome="fallback"} 1`,
+		`urlshort_requests_total{outcome="gone"} 1`,
+		`urlshort_requests_total{outcome="page"} 1`,
+		`urlshort_requests_total{outcome="locked"} 0`,
+		`urlshort_request_duration_seconds_bucket{le="+Inf"} 6`,
+		`urlshort_request_duration_seconds_count 6`,
+		`urlshort_lookup_duration_seconds_count{store="files"} 5`,
+		`urlshort_lookup_duration_seconds_bucket{store="redis",le="+Inf"} 5`,
+		`urlshort_store_errors_total{store="files"} 0`,
+		`urlshort_store_errors_total{store="redis"} 5`,
+	} {
+		if !strings.Contains(body, expected+"\n") {
+			t.Errorf("Expected %q in the metrics, got:\n%s\n", expected, body)
+		}
+	}
+}
+
+func TestReadyHandler(t *testing.T) {
+	var down error
+	h := ReadyHandler(map[string]func() error{
+		"redis": func() error { return down },
+	})
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/readyz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %v\n", rec.Code)
+	}
+
+	down = errors.New("connection refused")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), "redis: connection refused") {
+		t.Errorf("Expected status 503 with the Redis error, got %v:\n%s\n", rec.Code, rec.Body)
+	}
+}
+
+// storeFunc is a Store calling itself on Get
+type storeFunc func(path string) (Redirect, error)
+
+func (f storeFunc) Get(path string) (Redirect, error) {
+	return f(path)
+}
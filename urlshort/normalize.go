@@ -0,0 +1,269 @@
+package urlshort
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Normalization describes how the paths are normalized, both the
+// ones of the redirects when they are loaded and the ones of the
+// requests when they are matched, so that different spellings of
+// the same path lead to the same redirect.
+type Normalization struct {
+	// FoldCase makes the paths case insensitive: /Docs matches /docs.
+	// The names of the parameters are left alone, and their values
+	// keep the case of the request.
+	FoldCase bool
+
+	// TrailingSlash ignores the trailing slashes: /docs/ matches /docs.
+	TrailingSlash bool
+
+	// CollapseSlashes turns runs of slashes into a single one:
+	// //docs///intro matches /docs/intro.
+	CollapseSlashes bool
+
+	// Decode percent-decodes the paths of the redirects, like
+	// /caf%C3%A9, so they match the paths of the requests, which
+	// are always decoded.
+	Decode bool
+}
+
+// ParseNormalization returns the Normalization described by s, a
+// comma separated list of "case", "slash", "collapse" and "decode",
+// enabling FoldCase, TrailingSlash, CollapseSlashes and Decode.
+func ParseNormalization(s string) (Normalization, error) {
+	var n Normalization
+	for _, name := range strings.Split(s, ",") {
+		switch strings.TrimSpace(name) {
+		case "":
+		case "case":
+			n.FoldCase = true
+		case "slash":
+			n.TrailingSlash = true
+		case "collapse":
+			n.CollapseSlashes = true
+		case "decode":
+			n.Decode = true
+		default:
+			return Normalization{}, fmt.Errorf("unknown path normalization %q", name)
+		}
+	}
+
+	return n, nil
+}
+
+// NormalizePaths makes the handlers normalize the paths as described
+// by n. Handlers built from redirect data return an error if two
+// paths become the same once normalized.
+func NormalizePaths(n Normalization) Option {
+	return func(o *options) {
+		o.normalization = n
+	}
+}
+
+// Path returns the normalized form of the path of a request
+func (n Normalization) Path(path string) string {
+	return n.fold(n.clean(path))
+}
+
+// Key returns the same string for the paths of the redirects
+// matching the same requests once normalized, whatever the names
+// of their parameters
+func (n Normalization) Key(path string) string {
+	if normalized, err := n.redirectPath(path); err == nil {
+		path = normalized
+	}
+	return routeKey(path)
+}
+
+// samePath reports if the paths of two redirects are the same once
+// normalized
+func (n Normalization) samePath(a, b string) bool {
+	normalizedA, errA := n.redirectPath(a)
+	normalizedB, errB := n.redirectPath(b)
+	if errA != nil || errB != nil {
+		return a == b
+	}
+	return normalizedA == normalizedB
+}
+
+// clean applies the normalizations not changing the case of path
+func (n Normalization) clean(path string) string {
+	if n.CollapseSlashes {
+		for strings.Contains(path, "//") {
+			path = strings.Replace(path, "//", "/", -1)
+		}
+	}
+
+	if n.TrailingSlash && len(path) > 1 {
+		path = strings.TrimRight(path, "/")
+		if path == "" {
+			path = "/"
+		}
+	}
+
+	return path
+}
+
+// fold turns path in lower case, except the names of the parameters
+func (n Normalization) fold(path string) string {
+	if n.FoldCase {
+		segments := strings.Split(path, "/")
+		for i, segment := range segments {
+			if !strings.HasPrefix(segment, ":") {
+				segments[i] = strings.ToLower(segment)
+			}
+		}
+		path = strings.Join(segments, "/")
+	}
+
+	return path
+}
+
+// redirectPath returns the normalized form of the path of a redirect
+func (n Normalization) redirectPath(path string) (string, error) {
+	if n.Decode {
+		decoded, err := url.PathUnescape(path)
+		if err != nil {
+			return "", fmt.Errorf("invalid path %s: %v", path, err)
+		}
+		path = decoded
+	}
+
+	return n.Path(path), nil
+}
+
+// redirects returns redirects with their paths normalized,
+// or an error if two of them end up with the same path
+func (n Normalization) redirects(redirects []Redirect) ([]Redirect, error) {
+	if n == (Normalization{}) {
+		return redirects, nil
+	}
+
+	normalized := make([]Redirect, len(redirects))
+	definedBy := make(map[string]string, len(redirects))
+	for i, redirect := range redirects {
+		path, err := n.redirectPath(redirect.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		if other, ok := definedBy[path]; ok {
+			return nil, fmt.Errorf("paths %s and %s are the same once normalized to %s", other, redirect.Path, path)
+		}
+		definedBy[path] = redirect.Path
+
+		redirect.Path = path
+		normalized[i] = redirect
+	}
+
+	return normalized, nil
+}
+
+// mapRedirects returns the redirects of pathsToUrls with their paths
+// normalized: when two paths become the same, the first one in
+// lexical order wins, since MapHandler can't report errors
+func (n Normalization) mapRedirects(pathsToUrls map[string]string) []Redirect {
+	paths := make([]string, 0, len(pathsToUrls))
+	for path := range pathsToUrls {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var redirects []Redirect
+	defined := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		normalized, err := n.redirectPath(path)
+		if err != nil || defined[normalized] {
+			continue
+		}
+		defined[normalized] = true
+
+		redirects = append(redirects, Redirect{Path: normalized, URL: pathsToUrls[path]})
+	}
+
+	return redirects
+}
+
+// PathConflictError is returned by the stores of NormalizeStore when
+// a path becomes the same as the one of another redirect once
+// normalized, and by FileStore when a path matches the same requests
+// as the one of another redirect, like /gh/:user and /gh/:owner
+type PathConflictError struct {
+	Path       string // the path given
+	Other      string // the path of the other redirect
+	Normalized string // empty if the paths only match the same requests
+}
+
+func (e *PathConflictError) Error() string {
+	if e.Normalized == "" {
+		return fmt.Sprintf("paths %s and %s match the same requests", e.Other, e.Path)
+	}
+	return fmt.Sprintf("paths %s and %s are the same once normalized to %s", e.Other, e.Path, e.Normalized)
+}
+
+// NormalizeStore returns a WritableStore storing the redirects in
+// store with their paths normalized as described by n, as required
+// by StoreHandler, and looking them up the same way. Putting a
+// redirect whose path becomes the same as the one of another
+// redirect returns a *PathConflictError. The redirects stored
+// before with other spellings can still be got and deleted.
+func NormalizeStore(store WritableStore, n Normalization) WritableStore {
+	return &normalizedStore{WritableStore: store, normalization: n}
+}
+
+type normalizedStore struct {
+	WritableStore
+	normalization Normalization
+}
+
+func (s *normalizedStore) Get(path string) (Redirect, error) {
+	normalized, err := s.normalization.redirectPath(path)
+	if err != nil {
+		return Redirect{}, err
+	}
+
+	redirect, err := s.WritableStore.Get(normalized)
+	if err == ErrNotFound && normalized != path {
+		return s.WritableStore.Get(path)
+	}
+	return redirect, err
+}
+
+func (s *normalizedStore) Put(redirect Redirect) error {
+	normalized, err := s.normalization.redirectPath(redirect.Path)
+	if err != nil {
+		return err
+	}
+
+	redirects, err := s.List()
+	if err != nil {
+		return err
+	}
+	for _, other := range redirects {
+		if other.Path == normalized {
+			continue
+		}
+		if path, err := s.normalization.redirectPath(other.Path); err == nil && path == normalized {
+			return &PathConflictError{Path: redirect.Path, Other: other.Path, Normalized: normalized}
+		}
+	}
+
+	redirect.Path = normalized
+	return s.WritableStore.Put(redirect)
+}
+
+func (s *normalizedStore) Delete(path string) error {
+	normalized, err := s.normalization.redirectPath(path)
+	if err != nil {
+		return err
+	}
+
+	err = s.WritableStore.Delete(normalized)
+	if err == ErrNotFound && normalized != path {
+		return s.WritableStore.Delete(path)
+	}
+	return err
+}
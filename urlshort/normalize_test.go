@@ -0,0 +1,151 @@
+package urlshort
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNormalizationPath(t *testing.T) {
+	n := Normalization{FoldCase: true, TrailingSlash: true, CollapseSlashes: true}
+
+	for path, expected := range map[string]string{
+		"/":                "/",
+		"//":               "/",
+		"/Docs":            "/docs",
+		"/docs/":           "/docs",
+		"//Docs///Intro//": "/docs/intro",
+		"/GH/:User/:repo":  "/gh/:User/:repo",
+		"/docs/*":          "/docs/*",
+		"/CafÉ":            "/café",
+	} {
+		if normalized := n.Path(path); normalized != expected {
+			t.Errorf("Expected %s to be normalized to %s, got %s\n", path, expected, normalized)
+		}
+	}
+}
+
+func TestNormalizationKey(t *testing.T) {
+	n := Normalization{FoldCase: true, TrailingSlash: true, Decode: true}
+
+	for _, paths := range [][2]string{
+		{"/Docs/", "/docs"},
+		{"/GH/:user", "/gh/:owner"},
+		{"/caf%C3%A9/:a/x", "/Café/:b/x"},
+	} {
+		if n.Key(paths[0]) != n.Key(paths[1]) {
+			t.Errorf("Expected %s and %s to have the same key, got %s and %s\n", paths[0], paths[1], n.Key(paths[0]), n.Key(paths[1]))
+		}
+	}
+	if n.Key("/gh/:user") == n.Key("/gh/:user/x") {
+		t.Errorf("Expected /gh/:user and /gh/:user/x to have different keys\n")
+	}
+}
+
+func TestNormalizedHandler(t *testing.T) {
+	n, err := ParseNormalization("case,slash,collapse,decode")
+	if err != nil {
+		t.Fatalf("ParseNormalization failed with error %v\n", err)
+	}
+
+	data := []byte(`[
+		{"path": "/Docs/", "url": "https://example.com/docs"},
+		{"path": "/caf%C3%A9", "url": "https://example.com/cafe"},
+		{"path": "/gh/:User", "url": "https://github.com/:User"}
+	]`)
+	h, err := DataHandler(data, "json", http.NotFoundHandler(), NormalizePaths(n))
+	if err != nil {
+		t.Fatalf("DataHandler failed with error %v\n", err)
+	}
+
+	for path, location := range map[string]string{
+		"/docs":       "https://example.com/docs",
+		"/DOCS/":      "https://example.com/docs",
+		"//docs":      "https://example.com/docs",
+		"/café":       "https://example.com/cafe",
+		"/GH/Golang/": "https://github.com/Golang",
+	} {
+		expectLocation(t, h, path, location)
+	}
+
+	// without normalization only the exact path matches
+	h, err = DataHandler(data, "json", http.NotFoundHandler())
+	if err != nil {
+		t.Fatalf("DataHandler failed with error %v\n", err)
+	}
+	expectLocation(t, h, "/Docs/", "https://example.com/docs")
+	expectLocation(t, h, "/docs", "")
+}
+
+func TestNormalizationConflicts(t *testing.T) {
+	data := []byte(`[
+		{"path": "/docs", "url": "https://example.com/a"},
+		{"path": "/Docs/", "url": "https://example.com/b"}
+	]`)
+
+	if _, err := DataHandler(data, "json", http.NotFoundHandler(), NormalizePaths(Normalization{FoldCase: true, TrailingSlash: true})); err == nil {
+		t.Errorf("Expected DataHandler to fail on paths conflicting once normalized\n")
+	}
+
+	if _, err := DataHandler(data, "json", http.NotFoundHandler(), NormalizePaths(Normalization{FoldCase: true})); err != nil {
+		t.Errorf("Expected /docs and /docs/ to be different paths, got error %v\n", err)
+	}
+
+	if _, err := ParseNormalization("case,upper"); err == nil {
+		t.Errorf("Expected ParseNormalization to fail on an unknown normalization\n")
+	}
+}
+
+func TestNormalizedMapHandler(t *testing.T) {
+	h := MapHandler(map[string]string{
+		"/Docs": "https://example.com/a",
+		"/docs": "https://example.com/b",
+	}, http.NotFoundHandler(), NormalizePaths(Normalization{FoldCase: true}))
+
+	// the first path in lexical order wins
+	expectLocation(t, h, "/DOCS", "https://example.com/a")
+}
+
+func TestNormalizeStore(t *testing.T) {
+	n := Normalization{FoldCase: true, TrailingSlash: true}
+	memory := newMemoryStore(Redirect{Path: "/Old", URL: "https://example.com/old"})
+	store := NormalizeStore(memory, n)
+
+	if err := store.Put(Redirect{Path: "/Docs/", URL: "https://example.com/docs"}); err != nil {
+		t.Fatalf("Put failed with error %v\n", err)
+	}
+	if _, ok := memory["/docs"]; !ok {
+		t.Errorf("Expected /Docs/ to be stored as /docs, got %v\n", memory)
+	}
+	if redirect, err := store.Get("/DOCS"); err != nil || redirect.Path != "/docs" {
+		t.Errorf("Expected /DOCS to get /docs, got %v, %v\n", redirect, err)
+	}
+
+	h := StoreHandler(memory, http.NotFoundHandler(), nil, NormalizePaths(n))
+	expectLocation(t, h, "/Docs", "https://example.com/docs")
+
+	// the other spellings of the paths already stored conflict
+	err := store.Put(Redirect{Path: "/old", URL: "https://example.com/new"})
+	if _, ok := err.(*PathConflictError); !ok {
+		t.Errorf("Expected a PathConflictError, got %v\n", err)
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPut, "/links/OLD", strings.NewReader(`{"url": "https://example.com/new"}`))
+	AdminHandler(store, nil, nil).ServeHTTP(w, r)
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected status %d putting /OLD, got %d\n", http.StatusConflict, w.Code)
+	}
+
+	// but they can still be removed
+	if redirect, err := store.Get("/Old"); err != nil || redirect.URL != "https://example.com/old" {
+		t.Errorf("Expected to get /Old, got %v, %v\n", redirect, err)
+	}
+	if err := store.Delete("/Old"); err != nil {
+		t.Errorf("Delete failed with error %v\n", err)
+	}
+	if err := store.Put(Redirect{Path: "/old", URL: "https://example.com/new"}); err != nil {
+		t.Errorf("Put failed with error %v\n", err)
+	}
+}
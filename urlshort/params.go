@@ -0,0 +1,99 @@
+package urlshort
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// DefaultParams makes the handlers add params to the query of the
+// URL of every redirect, like the utm_source and utm_campaign of a
+// marketing campaign. The Params of a redirect take precedence over
+// them, and neither replace the parameters already in the URL or
+// passed by the visitor with PreserveQuery.
+func DefaultParams(params map[string]string) Option {
+	return func(o *options) {
+		o.params = params
+	}
+}
+
+// ParseParams returns the parameters in s, a query string like
+// "utm_source=newsletter&utm_medium=email", keeping the first
+// value of each one
+func ParseParams(s string) (map[string]string, error) {
+	values, err := url.ParseQuery(s)
+	if err != nil {
+		return nil, err
+	}
+
+	params := make(map[string]string, len(values))
+	for name, v := range values {
+		params[name] = v[0]
+	}
+	return params, nil
+}
+
+// withDefaultParams returns redirect with the default parameters
+// of o added to its own ones
+func (o *options) withDefaultParams(redirect Redirect) Redirect {
+	if len(o.params) == 0 {
+		return redirect
+	}
+
+	params := make(map[string]string, len(o.params)+len(redirect.Params))
+	for name, value := range o.params {
+		params[name] = value
+	}
+	for name, value := range redirect.Params {
+		params[name] = value
+	}
+	redirect.Params = params
+
+	return redirect
+}
+
+// addParams returns target with the params not already in its query
+// appended to it, in alphabetical order. The rest of target is left
+// as is, so that it can still contain placeholders like {rest}.
+func addParams(target string, params map[string]string) string {
+	if len(params) == 0 {
+		return target
+	}
+
+	fragment := ""
+	if i := strings.Index(target, "#"); i >= 0 {
+		target, fragment = target[:i], target[i:]
+	}
+
+	rawQuery := ""
+	if i := strings.Index(target, "?"); i >= 0 {
+		rawQuery = target[i+1:]
+	}
+	// the parameters parsed before an invalid one are kept
+	present, _ := url.ParseQuery(rawQuery)
+
+	names := make([]string, 0, len(params))
+	for name := range params {
+		if _, ok := present[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return target + fragment
+	}
+	sort.Strings(names)
+
+	query := make([]string, 0, len(names))
+	for _, name := range names {
+		query = append(query, url.QueryEscape(name)+"="+url.QueryEscape(params[name]))
+	}
+
+	switch {
+	case !strings.Contains(target, "?"):
+		target += "?"
+	case rawQuery != "" && !strings.HasSuffix(rawQuery, "&"):
+		target += "&"
+	}
+
+	return target + strings.Join(query, "&") + fragment
+}
@@ -0,0 +1,36 @@
+package urlshort
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestParams(t *testing.T) {
+	data := []byte(`[
+		{"path": "/a", "url": "https://example.com/a", "params": {"utm_campaign": "spring", "utm_source": "flyer"}},
+		{"path": "/b", "url": "https://example.com/b?utm_source=partner#top"},
+		{"path": "/c", "url": "https://example.com/c", "preserve_query": true}
+	]`)
+
+	defaults, err := ParseParams("utm_source=short&utm_medium=link&utm_medium=ignored")
+	if err != nil {
+		t.Fatalf("ParseParams failed with error %v\n", err)
+	}
+
+	h, err := DataHandler(data, "json", http.NotFoundHandler(), DefaultParams(defaults))
+	if err != nil {
+		t.Fatalf("DataHandler failed with error %v\n", err)
+	}
+
+	expectLocation(t, h, "/a", "https://example.com/a?utm_campaign=spring&utm_medium=link&utm_source=flyer")
+	expectLocation(t, h, "/b", "https://example.com/b?utm_source=partner&utm_medium=link#top")
+	expectLocation(t, h, "/c?utm_medium=qr&x=a+b", "https://example.com/c?utm_medium=qr&x=a+b&utm_source=short")
+
+	// without defaults only the params of the link are added
+	h, err = DataHandler(data, "json", http.NotFoundHandler())
+	if err != nil {
+		t.Fatalf("DataHandler failed with error %v\n", err)
+	}
+	expectLocation(t, h, "/b", "https://example.com/b?utm_source=partner#top")
+	expectLocation(t, h, "/c?x=1", "https://example.com/c?x=1")
+}
@@ -0,0 +1,95 @@
+package urlshort
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// page holds the data shown by the preview and warning pages
+type page struct {
+	Title    string
+	Path     string
+	Location string
+	Host     string
+}
+
+var previewPage = template.Must(template.New("preview").Parse(pageHeader + `
+<h1>{{.Title}}</h1>
+<p>The short link <code>{{.Path}}</code> leads to:</p>
+<p class="location">{{.Location}}</p>
+<a class="button" href="{{.Location}}">Continue to {{.Host}}</a>
+` + pageFooter))
+
+var warningPage = template.Must(template.New("warning").Parse(pageHeader + `
+<h1 class="warning">Warning</h1>
+<p>The short link <code>{{.Path}}</code> leads to <strong>{{.Host}}</strong>,
+which is on the list of domains considered unsafe:</p>
+<p class="location">{{.Location}}</p>
+<p>Continue only if you trust this website.</p>
+<a class="button warning" href="{{.Location}}">Continue anyway</a>
+` + pageFooter))
+
+const pageHeader = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; max-width: 40em; margin: 4em auto; padding: 0 1em; }
+.location { word-break: break-all; font-family: monospace; }
+.button { display: inline-block; padding: .5em 1em; background: #1a73e8; color: #fff; text-decoration: none; border-radius: 4px; }
+.warning { color: #c5221f; }
+.button.warning { background: #c5221f; color: #fff; }
+</style>
+</head>
+<body>`
+
+const pageFooter = `
+</body>
+</html>`
+
+// renderPage serves tmpl showing the destination
+// of redirect, that is location
+func renderPage(w http.ResponseWriter, tmpl *template.Template, redirect Redirect, location string) {
+	host := location
+	if target, err := url.Parse(location); err == nil {
+		host = target.Hostname()
+	}
+
+	title := redirect.Title
+	if title == "" {
+		title = host
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	tmpl.Execute(w, page{
+		Title:    title,
+		Path:     redirect.Path,
+		Location: location,
+		Host:     host,
+	})
+}
+
+// denied reports if the host of location is in the denylist
+func (o *options) denied(location string) bool {
+	if len(o.denylist) == 0 {
+		return false
+	}
+
+	target, err := url.Parse(location)
+	if err != nil {
+		return false
+	}
+
+	host := strings.ToLower(target.Hostname())
+	for _, domain := range o.denylist {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,71 @@
+package urlshort
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPreview(t *testing.T) {
+	data := `
+- path: /a
+  url: https://example.com/a
+  title: Example
+- path: /b
+  url: https://example.com/b
+  preview: true
+- path: /gh/:user
+  url: https://example.com/gh/:user
+- path: /docs/*
+  url: https://example.com/docs/{rest}
+`
+	h, err := DataHandler([]byte(data), "yaml", http.NotFoundHandler(), Preview())
+	if err != nil {
+		t.Fatalf("DataHandler failed with error %v\n", err)
+	}
+
+	expectLocation(t, h, "/a", "https://example.com/a")
+
+	for path, destination := range map[string]string{
+		"/a+":         "https://example.com/a",
+		"/b":          "https://example.com/b",
+		"/gh/golang+": "https://example.com/gh/golang",
+		"/docs/x+":    "https://example.com/docs/x",
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+
+		if rec.Code != http.StatusOK || rec.Header().Get("Location") != "" {
+			t.Errorf("Expected preview page for %v, got status %v\n", path, rec.Code)
+		}
+		if !strings.Contains(rec.Body.String(), `href="`+destination+`"`) {
+			t.Errorf("Expected preview page for %v to link %v, got %v\n", path, destination, rec.Body.String())
+		}
+	}
+}
+
+func TestPreviewDisabled(t *testing.T) {
+	h := MapHandler(map[string]string{"/a": "https://example.com/a"}, http.NotFoundHandler())
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/a+", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected /a+ to be passed to the fallback, got status %v\n", rec.Code)
+	}
+}
+
+func TestDenylist(t *testing.T) {
+	h := MapHandler(map[string]string{
+		"/bad":  "https://www.Evil.com/x",
+		"/good": "https://notevil.com/x",
+	}, http.NotFoundHandler(), Denylist([]string{" evil.com "}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/bad", nil))
+	if rec.Header().Get("Location") != "" || !strings.Contains(rec.Body.String(), "Warning") {
+		t.Errorf("Expected warning page for /bad, got status %v\n", rec.Code)
+	}
+
+	expectLocation(t, h, "/good", "https://notevil.com/x")
+}
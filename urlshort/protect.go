@@ -0,0 +1,104 @@
+package urlshort
+
+import (
+	"html/template"
+	"net/http"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// HashPassword returns the hash of password to be
+// stored in the Password field of a Redirect
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+
+	return string(hash), nil
+}
+
+var passwordPage = template.Must(template.New("password").Parse(pageHeader + `
+<h1>Protected link</h1>
+<p>The short link <code>{{.Path}}</code> is protected by a password.</p>
+{{if .Wrong}}<p class="warning">Wrong password, please try again.</p>{{end}}
+<form method="post">
+<input type="password" name="password" autofocus>
+<button class="button" type="submit">Continue</button>
+</form>
+` + pageFooter))
+
+// unlocked reports if the request carries the password of
+// redirect, serving the password form if it doesn't
+func unlocked(w http.ResponseWriter, r *http.Request, redirect Redirect) bool {
+	if redirect.Password == "" {
+		return true
+	}
+
+	var wrong bool
+	if r.Method == http.MethodPost {
+		err := bcrypt.CompareHashAndPassword([]byte(redirect.Password), []byte(r.PostFormValue("password")))
+		if err == nil {
+			return true
+		}
+		wrong = true
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if wrong {
+		w.WriteHeader(http.StatusForbidden)
+	} else {
+		w.WriteHeader(http.StatusUnauthorized)
+	}
+
+	passwordPage.Execute(w, struct {
+		Title string
+		Path  string
+		Wrong bool
+	}{
+		Title: "Protected link",
+		Path:  redirect.Path,
+		Wrong: wrong,
+	})
+
+	return false
+}
+
+// maxClicks returns the number of times redirect can be
+// followed, or zero if there is no limit
+func (rd Redirect) maxClicks() int64 {
+	if rd.OneTime {
+		return 1
+	}
+	return int64(rd.MaxClicks)
+}
+
+// exhausted reports if redirect can't be followed anymore
+func (o *options) exhausted(redirect Redirect) (bool, error) {
+	max := redirect.maxClicks()
+	if max == 0 {
+		return false, nil
+	}
+
+	clicks, err := o.counter.Count(redirect.Path)
+	if err != nil {
+		return false, err
+	}
+
+	return clicks >= max, nil
+}
+
+// click records that redirect is being followed, reporting
+// if it was still allowed to
+func (o *options) click(redirect Redirect) (bool, error) {
+	max := redirect.maxClicks()
+
+	clicks, err := o.counter.Incr(redirect.Path)
+	if err != nil {
+		// without the count only the unlimited links can be followed
+		return max == 0, err
+	}
+
+	return max == 0 || clicks <= max, nil
+}
@@ -0,0 +1,128 @@
+package urlshort
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestPasswordProtected(t *testing.T) {
+	hash, err := HashPassword("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := fmt.Sprintf(`[{"path": "/a", "url": "https://example.com/a", "password": %q}]`, hash)
+	h, err := DataHandler([]byte(data), "json", http.NotFoundHandler())
+	if err != nil {
+		t.Fatalf("DataHandler failed with error %v\n", err)
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/a", nil))
+	if rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Body.String(), "<form") {
+		t.Errorf("Expected password form, got status %v\n", rec.Code)
+	}
+
+	for password, status := range map[string]int{
+		"wrong":  http.StatusForbidden,
+		"secret": http.StatusSeeOther,
+	} {
+		form := url.Values{"password": {password}}
+		req := httptest.NewRequest("POST", "/a", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != status {
+			t.Errorf("Expected status %v with password %v, got %v\n", status, password, rec.Code)
+		}
+	}
+}
+
+func TestPasswordNotHashed(t *testing.T) {
+	data := `[{"path": "/a", "url": "https://example.com/a", "password": "secret"}]`
+
+	if _, err := DataHandler([]byte(data), "json", http.NotFoundHandler()); err == nil {
+		t.Errorf("Expected DataHandler to fail with a plain text password\n")
+	}
+}
+
+func TestMaxClicks(t *testing.T) {
+	data := `
+- path: /twice
+  url: https://example.com/twice
+  max_clicks: 2
+- path: /once
+  url: https://example.com/once
+  one_time: true
+`
+	counter := NewMemoryCounter()
+	h, err := DataHandler([]byte(data), "yaml", http.NotFoundHandler(), Clicks(counter))
+	if err != nil {
+		t.Fatalf("DataHandler failed with error %v\n", err)
+	}
+
+	expected := map[string][]int{
+		"/twice": {http.StatusFound, http.StatusFound, http.StatusGone},
+		"/once":  {http.StatusFound, http.StatusGone, http.StatusGone},
+	}
+	for path, statuses := range expected {
+		for i, status := range statuses {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+			if rec.Code != status {
+				t.Errorf("Expected status %v for click %v on %v, got %v\n", status, i+1, path, rec.Code)
+			}
+		}
+	}
+
+	if clicks, _ := counter.Count("/twice"); clicks != 2 {
+		t.Errorf("Expected 2 clicks recorded for /twice, got %v\n", clicks)
+	}
+}
+
+func TestMaxClicksPages(t *testing.T) {
+	data := `
+- path: /once
+  url: https://example.com/once
+  one_time: true
+- path: /twice
+  url: https://denied.example.net/twice
+  max_clicks: 2
+- path: /free
+  url: https://example.com/free
+`
+	counter := NewMemoryCounter()
+	h, err := DataHandler([]byte(data), "yaml", http.NotFoundHandler(), Clicks(counter), Preview(), Denylist([]string{"example.net"}))
+	if err != nil {
+		t.Fatalf("DataHandler failed with error %v\n", err)
+	}
+
+	// the preview and warning pages use the clicks up too
+	for _, test := range []struct {
+		path     string
+		statuses []int
+	}{
+		{"/once+", []int{http.StatusOK, http.StatusGone}},
+		{"/once", []int{http.StatusGone}},
+		{"/twice", []int{http.StatusOK, http.StatusOK, http.StatusGone}},
+		{"/free+", []int{http.StatusOK, http.StatusOK}},
+	} {
+		for i, status := range test.statuses {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest("GET", test.path, nil))
+			if rec.Code != status {
+				t.Errorf("Expected status %v for request %v on %v, got %v\n", status, i+1, test.path, rec.Code)
+			}
+		}
+	}
+
+	// but not the previews of the other links
+	if clicks, _ := counter.Count("/free"); clicks != 0 {
+		t.Errorf("Expected no clicks recorded for /free, got %v\n", clicks)
+	}
+}
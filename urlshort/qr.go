@@ -0,0 +1,145 @@
+package urlshort
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+const (
+	defaultQRSize = 256
+	maxQRSize     = 2048
+)
+
+// QRCodes enables the QR code endpoints: appending ".qr" to a short
+// path, or prefixing it with "/qr", returns a QR code of the full
+// short URL instead of redirecting.
+//
+// The short URLs start with baseURL, like "https://go.example.com",
+// or with the scheme and host of the request if baseURL is empty.
+//
+// The QR code is a PNG image, or an SVG one if the format query
+// parameter is "svg". The size in pixels and the error correction
+// level (L, M, Q or H) can be set with the size and level query
+// parameters.
+func QRCodes(baseURL string) Option {
+	return func(o *options) {
+		o.qr = true
+		o.baseURL = strings.TrimSuffix(baseURL, "/")
+	}
+}
+
+// qrPath returns the short path whose QR code is requested
+// with path, if any
+func (o *options) qrPath(path string) (string, bool) {
+	if !o.qr {
+		return "", false
+	}
+
+	if strings.HasSuffix(path, ".qr") {
+		return strings.TrimSuffix(path, ".qr"), true
+	}
+
+	if strings.HasPrefix(path, "/qr/") {
+		return strings.TrimPrefix(path, "/qr"), true
+	}
+
+	return "", false
+}
+
+// shortURL returns the full short URL of path
+func (o *options) shortURL(r *http.Request, path string) string {
+	if o.baseURL != "" {
+		return o.baseURL + path
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	return scheme + "://" + r.Host + path
+}
+
+// serveQR serves the QR code of the short URL of path
+func (o *options) serveQR(w http.ResponseWriter, r *http.Request, path string) {
+	query := r.URL.Query()
+
+	size := defaultQRSize
+	if s := query.Get("size"); s != "" {
+		var err error
+		size, err = strconv.Atoi(s)
+		if err != nil || size < 1 || size > maxQRSize {
+			http.Error(w, fmt.Sprintf("size must be between 1 and %d", maxQRSize), http.StatusBadRequest)
+			return
+		}
+	}
+
+	level, ok := qrLevels[strings.ToUpper(query.Get("level"))]
+	if !ok {
+		http.Error(w, "level must be one of L, M, Q or H", http.StatusBadRequest)
+		return
+	}
+
+	code, err := qrcode.New(o.shortURL(r, path), level)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	switch query.Get("format") {
+	case "", "png":
+		png, err := code.PNG(size)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(png)
+	case "svg":
+		w.Header().Set("Content-Type", "image/svg+xml")
+		w.Write([]byte(qrSVG(code.Bitmap(), size)))
+	default:
+		http.Error(w, "format must be png or svg", http.StatusBadRequest)
+	}
+}
+
+var qrLevels = map[string]qrcode.RecoveryLevel{
+	"":  qrcode.Medium,
+	"L": qrcode.Low,
+	"M": qrcode.Medium,
+	"Q": qrcode.High,
+	"H": qrcode.Highest,
+}
+
+// qrSVG draws bitmap as an SVG image of size pixels,
+// merging the adjacent dark modules of each row
+func qrSVG(bitmap [][]bool, size int) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`,
+		size, size, len(bitmap), len(bitmap))
+	b.WriteString(`<rect width="100%" height="100%" fill="#fff"/><path fill="#000" d="`)
+
+	for y, row := range bitmap {
+		for x := 0; x < len(row); x++ {
+			if !row[x] {
+				continue
+			}
+
+			start := x
+			for x < len(row) && row[x] {
+				x++
+			}
+			fmt.Fprintf(&b, "M%d %dh%dv1h-%dz", start, y, x-start, x-start)
+		}
+	}
+
+	b.WriteString(`"/></svg>`)
+
+	return b.String()
+}
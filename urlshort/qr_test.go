@@ -0,0 +1,79 @@
+package urlshort
+
+import (
+	"bytes"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestQRCodes(t *testing.T) {
+	h := MapHandler(map[string]string{
+		"/a": "https://example.com/a",
+	}, http.NotFoundHandler(), QRCodes("https://go.example.com/"))
+
+	for _, path := range []string{"/a.qr", "/qr/a"} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", path+"?size=100&level=H", nil))
+
+		if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "image/png" {
+			t.Fatalf("Expected PNG QR code for %v, got status %v\n", path, rec.Code)
+		}
+
+		img, err := png.Decode(bytes.NewReader(rec.Body.Bytes()))
+		if err != nil {
+			t.Fatalf("Expected a valid PNG for %v, got error %v\n", path, err)
+		}
+		if img.Bounds().Dx() != 100 {
+			t.Errorf("Expected a 100px image for %v, got %v\n", path, img.Bounds().Dx())
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/a.qr?format=svg", nil))
+	if rec.Header().Get("Content-Type") != "image/svg+xml" || !strings.HasPrefix(rec.Body.String(), "<svg") {
+		t.Errorf("Expected SVG QR code, got %v\n", rec.Body.String())
+	}
+
+	for _, path := range []string{"/b.qr", "/a.qr?size=0", "/a.qr?level=X", "/a.qr?format=gif"} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		if rec.Code == http.StatusOK {
+			t.Errorf("Expected %v to fail\n", path)
+		}
+	}
+}
+
+func TestQRCodesPatterns(t *testing.T) {
+	data := []byte(`[
+		{"path": "/gh/:user/:repo", "url": "https://github.com/:user/:repo"},
+		{"path": "/docs/*", "url": "https://docs.example.com/{rest}"}
+	]`)
+	h, err := DataHandler(data, "json", http.NotFoundHandler(), QRCodes(""))
+	if err != nil {
+		t.Fatalf("DataHandler failed with error %v\n", err)
+	}
+
+	// the parameters and wildcards don't take the QR paths
+	for _, path := range []string{"/gh/x/y.qr", "/docs/intro.qr", "/qr/docs/a/b", "/qr/gh/x/y"} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "image/png" {
+			t.Errorf("Expected PNG QR code for %v, got status %v to %v\n", path, rec.Code, rec.Header().Get("Location"))
+		}
+	}
+
+	expectLocation(t, h, "/docs/intro", "https://docs.example.com/intro")
+}
+
+func TestShortURL(t *testing.T) {
+	o := newOptions([]Option{QRCodes("")})
+
+	req := httptest.NewRequest("GET", "/a.qr", nil)
+	req.Host = "go.example.com"
+	if url := o.shortURL(req, "/a"); url != "http://go.example.com/a" {
+		t.Errorf("Expected http://go.example.com/a, got %v\n", url)
+	}
+}
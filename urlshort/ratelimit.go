@@ -0,0 +1,201 @@
+package urlshort
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimiter limits the rate of the requests coming from each
+// client IP address, using a token bucket algorithm: every client
+// can make up to burst requests at once, then one more every
+// 1/rate seconds.
+//
+// The client address is the remote address of the connection,
+// unless it belongs to a trusted proxy: in that case the client
+// address is read from the X-Forwarded-For header, skipping the
+// addresses of the other trusted proxies.
+type RateLimiter struct {
+	rate    float64
+	burst   float64
+	trusted TrustedProxies
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter returns a RateLimiter allowing rate requests per
+// second, with bursts of up to burst requests, from each client.
+// trustedProxies is a list of IP addresses or CIDR ranges whose
+// X-Forwarded-For header is trusted.
+func NewRateLimiter(rate float64, burst int, trustedProxies []string) (*RateLimiter, error) {
+	if rate <= 0 || burst < 1 {
+		return nil, fmt.Errorf("invalid rate limit: %v requests per second with burst %d", rate, burst)
+	}
+
+	trusted, err := ParseTrustedProxies(trustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		trusted: trusted,
+		buckets: make(map[string]*bucket),
+	}, nil
+}
+
+// Handler returns an http.Handler passing the requests to h until
+// the client exceeds the rate limit, answering 429 Too Many Requests
+// with a Retry-After header from then on.
+func (l *RateLimiter) Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		allowed, wait := l.Allow(l.ClientIP(r))
+		if !allowed {
+			seconds := int(math.Ceil(wait.Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(seconds))
+			http.Error(w, "429 too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+// Allow takes a token from the bucket of client, reporting if
+// there was one. If not, it returns how long the client has to
+// wait for the next one.
+func (l *RateLimiter) Allow(client string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	t := now()
+	l.sweep(t)
+
+	b, ok := l.buckets[client]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: t}
+		l.buckets[client] = b
+	}
+
+	b.tokens = math.Min(l.burst, b.tokens+t.Sub(b.last).Seconds()*l.rate)
+	b.last = t
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+		return false, wait
+	}
+
+	b.tokens--
+	return true, 0
+}
+
+// sweep drops, at most once per minute, the buckets that
+// have been refilled, since they are the same as new ones
+func (l *RateLimiter) sweep(t time.Time) {
+	if t.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = t
+
+	for client, b := range l.buckets {
+		if b.tokens+t.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, client)
+		}
+	}
+}
+
+// ClientIP returns the IP address of the client making the request
+func (l *RateLimiter) ClientIP(r *http.Request) string {
+	return l.trusted.ClientIP(r)
+}
+
+// TrustedProxies are the networks of the proxies
+// whose X-Forwarded-For header is trusted
+type TrustedProxies []*net.IPNet
+
+// ParseTrustedProxies returns the TrustedProxies
+// in list, made of IP addresses or CIDR ranges
+func ParseTrustedProxies(list []string) (TrustedProxies, error) {
+	var trusted TrustedProxies
+	for _, proxy := range list {
+		proxy = strings.TrimSpace(proxy)
+		if proxy == "" {
+			continue
+		}
+
+		if !strings.Contains(proxy, "/") {
+			if strings.Contains(proxy, ":") {
+				proxy += "/128"
+			} else {
+				proxy += "/32"
+			}
+		}
+
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %s: %v", proxy, err)
+		}
+		trusted = append(trusted, network)
+	}
+
+	return trusted, nil
+}
+
+// ClientIP returns the IP address of the client making the request:
+// the remote address of the connection, unless it belongs to one of
+// p, in which case it's read from the X-Forwarded-For header
+func (p TrustedProxies) ClientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+
+	if !p.isTrusted(ip) {
+		return ip
+	}
+
+	// walk the list from the closest hop to the farthest,
+	// the first address not belonging to a proxy is the client
+	forwarded := strings.Split(strings.Join(r.Header["X-Forwarded-For"], ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(forwarded[i])
+		if hop == "" {
+			continue
+		}
+
+		ip = hop
+		if !p.isTrusted(hop) {
+			break
+		}
+	}
+
+	return ip
+}
+
+func (p TrustedProxies) isTrusted(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+
+	for _, network := range p {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+
+	return false
+}
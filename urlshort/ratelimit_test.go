@@ -0,0 +1,83 @@
+package urlshort
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterHandler(t *testing.T) {
+	defer func() { now = time.Now }()
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	now = func() time.Time { return start }
+
+	l, err := NewRateLimiter(0.5, 2, nil)
+	if err != nil {
+		t.Fatalf("NewRateLimiter failed with error %v\n", err)
+	}
+	h := l.Handler(MapHandler(map[string]string{"/a": "https://example.com"}, http.NotFoundHandler()))
+
+	request := func(remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/a", nil)
+		req.RemoteAddr = remoteAddr
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for i := 0; i < 2; i++ {
+		if rec := request("10.0.0.1:1234"); rec.Code != http.StatusFound {
+			t.Errorf("Expected request %v to be allowed, got status %v\n", i+1, rec.Code)
+		}
+	}
+
+	rec := request("10.0.0.1:1234")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected status %v, got %v\n", http.StatusTooManyRequests, rec.Code)
+	}
+	if retry := rec.Header().Get("Retry-After"); retry != "2" {
+		t.Errorf("Expected Retry-After 2, got %q\n", retry)
+	}
+
+	if rec := request("10.0.0.2:1234"); rec.Code != http.StatusFound {
+		t.Errorf("Expected another client to be allowed, got status %v\n", rec.Code)
+	}
+
+	now = func() time.Time { return start.Add(2 * time.Second) }
+	if rec := request("10.0.0.1:1234"); rec.Code != http.StatusFound {
+		t.Errorf("Expected request to be allowed after waiting, got status %v\n", rec.Code)
+	}
+}
+
+func TestRateLimiterClientIP(t *testing.T) {
+	l, err := NewRateLimiter(1, 1, []string{"10.0.0.1", "192.168.0.0/16"})
+	if err != nil {
+		t.Fatalf("NewRateLimiter failed with error %v\n", err)
+	}
+
+	tests := []struct {
+		remoteAddr string
+		forwarded  string
+		expected   string
+	}{
+		{"1.2.3.4:1000", "5.6.7.8", "1.2.3.4"},
+		{"10.0.0.1:1000", "", "10.0.0.1"},
+		{"10.0.0.1:1000", "5.6.7.8", "5.6.7.8"},
+		{"10.0.0.1:1000", "9.9.9.9, 5.6.7.8, 192.168.1.1", "5.6.7.8"},
+		{"10.0.0.1:1000", "192.168.1.2, 192.168.1.1", "192.168.1.2"},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = test.remoteAddr
+		if test.forwarded != "" {
+			req.Header.Set("X-Forwarded-For", test.forwarded)
+		}
+
+		if ip := l.ClientIP(req); ip != test.expected {
+			t.Errorf("Expected client %v for %+v, got %v\n", test.expected, test, ip)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package urlshort
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mediocregopher/radix.v2/pool"
+	"github.com/mediocregopher/radix.v2/redis"
+)
+
+// RedisOptions holds the settings used to connect to Redis
+type RedisOptions struct {
+	Addr     string
+	Password string
+	DB       int
+	PoolSize int
+	Timeout  time.Duration
+}
+
+// NewRedisPool returns a pool of connections to the Redis server
+// described by opts, authenticated and using the selected database.
+// If the server can't be reached, the pool is returned anyway along
+// with the error: it will try again to connect on the next commands.
+func NewRedisPool(opts RedisOptions) (*pool.Pool, error) {
+	dial := func(network, addr string) (*redis.Client, error) {
+		client, err := redis.DialTimeout(network, addr, opts.Timeout)
+		if err != nil {
+			return nil, err
+		}
+
+		if opts.Password != "" {
+			if err := client.Cmd("AUTH", opts.Password).Err; err != nil {
+				client.Close()
+				return nil, err
+			}
+		}
+
+		if opts.DB != 0 {
+			if err := client.Cmd("SELECT", opts.DB).Err; err != nil {
+				client.Close()
+				return nil, err
+			}
+		}
+
+		return client, nil
+	}
+
+	return pool.NewCustom("tcp", opts.Addr, opts.PoolSize, dial)
+}
+
+// RedisStore is a Store reading the redirects from a Redis hash.
+//
+// The fields of the hash are the paths, the values are either the
+// URL to redirect to or a JSON object in the same format used by
+// DataHandler, like:
+//
+//	HSET urlshort /some-path https://www.some-url.com/demo
+//	HSET urlshort /other-path '{"url": "https://www.some-url.com/other", "status": 301}'
+//
+// When a command fails, the store stops querying Redis for a while,
+// returning ErrUnavailable instead, so that the requests don't have
+// to wait for Redis to time out while it is unreachable.
+type RedisStore struct {
+	pool       *pool.Pool
+	key        string
+	retryAfter time.Duration
+
+	mu      sync.Mutex
+	retryAt time.Time
+}
+
+// NewRedisStore returns a RedisStore reading the hash
+// stored at key using the connections from p.
+func NewRedisStore(p *pool.Pool, key string) *RedisStore {
+	return &RedisStore{
+		pool:       p,
+		key:        key,
+		retryAfter: 5 * time.Second,
+	}
+}
+
+// Get returns the redirect stored for path
+func (s *RedisStore) Get(path string) (Redirect, error) {
+	resp, err := s.cmd("HGET", s.key, path)
+	if err != nil {
+		return Redirect{}, err
+	}
+
+	if resp.IsType(redis.Nil) {
+		return Redirect{}, ErrNotFound
+	}
+
+	value, err := resp.Str()
+	if err != nil {
+		return Redirect{}, err
+	}
+
+	return decodeRedisValue(path, value)
+}
+
+// List returns all the redirects in the hash, ordered by path
+func (s *RedisStore) List() ([]Redirect, error) {
+	resp, err := s.cmd("HGETALL", s.key)
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := resp.Map()
+	if err != nil {
+		return nil, err
+	}
+
+	redirects := make([]Redirect, 0, len(values))
+	for path, value := range values {
+		redirect, err := decodeRedisValue(path, value)
+		if err != nil {
+			return nil, err
+		}
+		redirects = append(redirects, redirect)
+	}
+
+	sort.Slice(redirects, func(i, j int) bool {
+		return redirects[i].Path < redirects[j].Path
+	})
+
+	return redirects, nil
+}
+
+// Put stores redirect in the hash, as a plain URL
+// unless it has other fields set
+func (s *RedisStore) Put(redirect Redirect) error {
+	if err := redirect.validate(); err != nil {
+		return err
+	}
+
+	value := redirect.URL
+	if redirect.hasOptions() {
+		data, err := json.Marshal(redirect)
+		if err != nil {
+			return err
+		}
+		value = string(data)
+	}
+
+	_, err := s.cmd("HSET", s.key, redirect.Path, value)
+	return err
+}
+
+// Delete removes the redirect for path from the hash
+func (s *RedisStore) Delete(path string) error {
+	resp, err := s.cmd("HDEL", s.key, path)
+	if err != nil {
+		return err
+	}
+
+	deleted, err := resp.Int()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// Incr increments the clicks of path, stored in the
+// hash at the same key of the redirects plus ":clicks"
+func (s *RedisStore) Incr(path string) (int64, error) {
+	resp, err := s.cmd("HINCRBY", s.key+":clicks", path, 1)
+	if err != nil {
+		return 0, err
+	}
+
+	return resp.Int64()
+}
+
+// Count returns the clicks of path
+func (s *RedisStore) Count(path string) (int64, error) {
+	resp, err := s.cmd("HGET", s.key+":clicks", path)
+	if err != nil {
+		return 0, err
+	}
+
+	if resp.IsType(redis.Nil) {
+		return 0, nil
+	}
+
+	return resp.Int64()
+}
+
+// Ping checks that the Redis server is reachable
+func (s *RedisStore) Ping() error {
+	return s.pool.Cmd("PING").Err
+}
+
+// cmd runs a command, unless a previous one failed recently
+func (s *RedisStore) cmd(cmd string, args ...interface{}) (*redis.Resp, error) {
+	s.mu.Lock()
+	down := now().Before(s.retryAt)
+	s.mu.Unlock()
+
+	if down {
+		return nil, ErrUnavailable
+	}
+
+	resp := s.pool.Cmd(cmd, args...)
+	if resp.Err != nil {
+		s.mu.Lock()
+		s.retryAt = now().Add(s.retryAfter)
+		s.mu.Unlock()
+
+		return nil, resp.Err
+	}
+
+	return resp, nil
+}
+
+func decodeRedisValue(path, value string) (Redirect, error) {
+	redirect := Redirect{URL: value}
+
+	if strings.HasPrefix(strings.TrimSpace(value), "{") {
+		redirect = Redirect{}
+		if err := json.Unmarshal([]byte(value), &redirect); err != nil {
+			return Redirect{}, fmt.Errorf("invalid value for path %s: %v", path, err)
+		}
+	}
+	redirect.Path = path
+
+	if err := redirect.validate(); err != nil {
+		return Redirect{}, err
+	}
+
+	return redirect, nil
+}
@@ -0,0 +1,201 @@
+package urlshort
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mediocregopher/radix.v2/redis"
+)
+
+// fakeRedis is a minimal in-process server speaking the
+// Redis protocol, supporting only the commands used by RedisStore
+type fakeRedis struct {
+	listener net.Listener
+
+	mu     sync.Mutex
+	hashes map[string]map[string]string
+	conns  []net.Conn
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := &fakeRedis{
+		listener: l,
+		hashes:   make(map[string]map[string]string),
+	}
+	go f.serve()
+
+	return f
+}
+
+func (f *fakeRedis) addr() string {
+	return f.listener.Addr().String()
+}
+
+func (f *fakeRedis) hset(key, field, value string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.hashes[key] == nil {
+		f.hashes[key] = make(map[string]string)
+	}
+	f.hashes[key][field] = value
+}
+
+// close stops the server, dropping all the open connections
+func (f *fakeRedis) close() {
+	f.listener.Close()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, conn := range f.conns {
+		conn.Close()
+	}
+}
+
+func (f *fakeRedis) serve() {
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		f.mu.Lock()
+		f.conns = append(f.conns, conn)
+		f.mu.Unlock()
+
+		go f.handle(conn)
+	}
+}
+
+func (f *fakeRedis) handle(conn net.Conn) {
+	defer conn.Close()
+
+	rr := redis.NewRespReader(conn)
+	for {
+		args, err := rr.Read().List()
+		if err != nil || len(args) == 0 {
+			return
+		}
+
+		if _, err := f.exec(args).WriteTo(conn); err != nil {
+			return
+		}
+	}
+}
+
+func (f *fakeRedis) exec(args []string) *redis.Resp {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch strings.ToUpper(args[0]) {
+	case "PING":
+		return redis.NewRespSimple("PONG")
+	case "HGET":
+		if value, ok := f.hashes[args[1]][args[2]]; ok {
+			return redis.NewResp(value)
+		}
+		return redis.NewResp(nil)
+	}
+
+	return redis.NewResp(errors.New("ERR unknown command"))
+}
+
+func newTestRedisStore(t *testing.T, f *fakeRedis) *RedisStore {
+	p, err := NewRedisPool(RedisOptions{
+		Addr:     f.addr(),
+		PoolSize: 2,
+		Timeout:  time.Second,
+	})
+	if err != nil {
+		t.Fatalf("NewRedisPool failed with error %v\n", err)
+	}
+
+	return NewRedisStore(p, "urlshort")
+}
+
+func TestRedisStoreGet(t *testing.T) {
+	f := newFakeRedis(t)
+	defer f.close()
+
+	f.hset("urlshort", "/plain", "https://example.com/plain")
+	f.hset("urlshort", "/json", `{"url": "https://example.com/json", "status": 301}`)
+	f.hset("urlshort", "/invalid", "example.com")
+
+	s := newTestRedisStore(t, f)
+
+	redirect, err := s.Get("/plain")
+	if err != nil || redirect.URL != "https://example.com/plain" {
+		t.Errorf("Expected /plain to redirect to https://example.com/plain, got %v (%v)\n", redirect, err)
+	}
+
+	redirect, err = s.Get("/json")
+	if err != nil || redirect.URL != "https://example.com/json" || redirect.Status != 301 {
+		t.Errorf("Expected /json to redirect to https://example.com/json with 301, got %v (%v)\n", redirect, err)
+	}
+
+	if _, err := s.Get("/missing"); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound for /missing, got %v\n", err)
+	}
+
+	if _, err := s.Get("/invalid"); err == nil {
+		t.Errorf("Expected an error for /invalid\n")
+	}
+}
+
+func TestStoreHandlerRedisDown(t *testing.T) {
+	f := newFakeRedis(t)
+	f.hset("urlshort", "/a", "https://redis.example.com/a")
+
+	s := newTestRedisStore(t, f)
+	fallback := MapHandler(map[string]string{
+		"/a": "https://file.example.com/a",
+	}, http.NotFoundHandler())
+
+	var errs []error
+	h := StoreHandler(s, fallback, func(err error) {
+		errs = append(errs, err)
+	})
+
+	expectLocation(t, h, "/a", "https://redis.example.com/a")
+
+	f.close()
+
+	expectLocation(t, h, "/a", "https://file.example.com/a")
+	expectLocation(t, h, "/a", "https://file.example.com/a")
+
+	if len(errs) != 2 || errs[0] == ErrUnavailable || errs[1] != ErrUnavailable {
+		t.Errorf("Expected a Redis error followed by ErrUnavailable, got %v\n", errs)
+	}
+}
+
+func TestCachedStore(t *testing.T) {
+	f := newFakeRedis(t)
+	defer f.close()
+	f.hset("urlshort", "/a", "https://example.com/old")
+
+	s := NewCachedStore(newTestRedisStore(t, f), time.Minute, 10)
+
+	if redirect, _ := s.Get("/a"); redirect.URL != "https://example.com/old" {
+		t.Errorf("Expected https://example.com/old, got %v\n", redirect.URL)
+	}
+
+	f.hset("urlshort", "/a", "https://example.com/new")
+	if redirect, _ := s.Get("/a"); redirect.URL != "https://example.com/old" {
+		t.Errorf("Expected cached https://example.com/old, got %v\n", redirect.URL)
+	}
+
+	s.Forget("/a")
+	if redirect, _ := s.Get("/a"); redirect.URL != "https://example.com/new" {
+		t.Errorf("Expected https://example.com/new, got %v\n", redirect.URL)
+	}
+}
@@ -0,0 +1,185 @@
+package urlshort
+
+import (
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// FileHandler is an http.Handler serving the redirects stored
+// in one or more sources, usually files.
+// The sources can be read again at any time calling Reload: the
+// redirect table is swapped atomically, so the requests already
+// being served keep using the table they started with.
+type FileHandler struct {
+	sources  []Source
+	fallback http.Handler
+	opts     *options
+
+	mu        sync.Mutex // serializes the reloads
+	modTimes  map[string]time.Time
+	conflicts []Conflict
+	redirects []Redirect
+	current   atomic.Value // holds an http.Handler
+}
+
+// NewFileHandler reads the redirects from the file at path, in one
+// of the formats supported by DataHandler following format parameter,
+// and returns a FileHandler serving them. If format is empty, it is
+// detected from the file extension.
+// If the path is not provided in the file, then the fallback
+// http.Handler will be called instead.
+// An error is returned if the file can't be read or parsed.
+// The handler behaviour can be customized with opts.
+func NewFileHandler(path, format string, fallback http.Handler, opts ...Option) (*FileHandler, error) {
+	return NewSourcesHandler([]Source{{Path: path, Format: format}}, fallback, opts...)
+}
+
+// NewSourcesHandler is like NewFileHandler, but reads the redirects
+// from several sources, merged in priority order as in LoadSources.
+// The conflicts between the sources can be read with Conflicts.
+func NewSourcesHandler(sources []Source, fallback http.Handler, opts ...Option) (*FileHandler, error) {
+	h := &FileHandler{
+		sources:  sources,
+		fallback: fallback,
+		opts:     newOptions(opts),
+	}
+
+	if err := h.Reload(); err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
+
+// ServeHTTP serves the request using the last successfully
+// loaded redirect table.
+func (h *FileHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.current.Load().(http.Handler).ServeHTTP(w, r)
+}
+
+// Conflicts returns the paths defined in more than one source
+// found by the last successful reload.
+func (h *FileHandler) Conflicts() []Conflict {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.conflicts
+}
+
+// Redirects returns the redirects loaded by
+// the last successful reload.
+func (h *FileHandler) Redirects() []Redirect {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.redirects
+}
+
+// Reload reads and parses the sources again, swapping the redirect
+// table on success.
+// If any source can't be read or contains invalid data, the error is
+// returned and the previous redirect table is kept.
+func (h *FileHandler) Reload() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	modTimes, err := h.stat()
+	if err != nil {
+		return err
+	}
+
+	// remember the versions even if they turn out to be invalid,
+	// so Watch won't try again until a file is changed
+	h.modTimes = modTimes
+
+	redirects, conflicts, err := LoadSources(h.sources)
+	if err != nil {
+		return err
+	}
+
+	redirects, err = h.opts.normalization.redirects(redirects)
+	if err != nil {
+		return err
+	}
+
+	redirects, err = h.opts.chains.resolve(redirects, h.opts.normalization)
+	if err != nil {
+		return err
+	}
+
+	rt, err := newRouter(redirects)
+	if err != nil {
+		return err
+	}
+
+	h.current.Store(http.Handler(routerHandler(rt, h.fallback, h.opts)))
+	h.conflicts = conflicts
+	h.redirects = redirects
+
+	return nil
+}
+
+// Watch checks the files every interval and reloads them when the
+// modification time of any of them changes, until stop is closed.
+// Errors occurred while reloading are passed to onError, if not nil.
+func (h *FileHandler) Watch(interval time.Duration, stop <-chan struct{}, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		changed, err := h.changed()
+		if err == nil && changed {
+			err = h.Reload()
+		}
+
+		if err != nil && onError != nil {
+			onError(err)
+		}
+	}
+}
+
+func (h *FileHandler) changed() (bool, error) {
+	modTimes, err := h.stat()
+	if err != nil {
+		return false, err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for path, modTime := range modTimes {
+		if !modTime.Equal(h.modTimes[path]) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// stat returns the modification time of each file source
+func (h *FileHandler) stat() (map[string]time.Time, error) {
+	modTimes := make(map[string]time.Time)
+
+	for _, source := range h.sources {
+		if source.Format == "env" {
+			continue
+		}
+
+		info, err := os.Stat(source.Path)
+		if err != nil {
+			return nil, err
+		}
+		modTimes[source.Path] = info.ModTime()
+	}
+
+	return modTimes, nil
+}
@@ -0,0 +1,73 @@
+package urlshort
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileHandlerReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "urlshort")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "redirects.yml")
+	writeFile(t, path, "- path: /a\n  url: https://a.example.com\n")
+
+	h, err := NewFileHandler(path, "yaml", http.NotFoundHandler())
+	if err != nil {
+		t.Fatalf("NewFileHandler failed with error %v\n", err)
+	}
+	expectLocation(t, h, "/a", "https://a.example.com")
+
+	writeFile(t, path, "- path: /b\n  url: https://b.example.com\n")
+	if err := h.Reload(); err != nil {
+		t.Fatalf("Reload failed with error %v\n", err)
+	}
+	expectLocation(t, h, "/b", "https://b.example.com")
+	expectLocation(t, h, "/a", "")
+}
+
+func TestFileHandlerReloadInvalidKeepsTable(t *testing.T) {
+	dir, err := ioutil.TempDir("", "urlshort")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "redirects.json")
+	writeFile(t, path, `[{"path": "/a", "url": "https://a.example.com"}]`)
+
+	h, err := NewFileHandler(path, "json", http.NotFoundHandler())
+	if err != nil {
+		t.Fatalf("NewFileHandler failed with error %v\n", err)
+	}
+
+	writeFile(t, path, `[{"path": "/a", "url": `)
+	if err := h.Reload(); err == nil {
+		t.Errorf("Expected Reload to fail on invalid data\n")
+	}
+	expectLocation(t, h, "/a", "https://a.example.com")
+}
+
+func writeFile(t *testing.T, path, content string) {
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// expectLocation checks that a request to path is redirected
+// to location, or not redirected at all if location is empty.
+func expectLocation(t *testing.T, h http.Handler, path, location string) {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+
+	if got := rec.Header().Get("Location"); got != location {
+		t.Errorf("Expected %v to redirect to %q, got %q\n", path, location, got)
+	}
+}
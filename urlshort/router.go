@@ -0,0 +1,301 @@
+package urlshort
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// router is the compiled form of a redirect table.
+//
+// Three kinds of paths are supported:
+//
+//	/exact/path       matches only the very same path
+//	/gh/:user/:repo   matches any value in place of the named
+//	                  parameters, which are substituted to the
+//	                  :user and :repo placeholders in the URL
+//	/docs/*           matches every path starting with /docs/,
+//	                  the rest of the path is substituted to the
+//	                  {rest} placeholder in the URL
+//
+// When more than one path matches a request, exact paths win over
+// paths with parameters, which in turn win over wildcards.
+// Between paths with parameters, static segments win over parameters
+// going from left to right. Between wildcards, the longest one wins.
+type router struct {
+	exact     map[string]Redirect
+	params    *node
+	wildcards map[string]Redirect // keyed by prefix, trailing '/' included
+
+	// foldCase makes the static parts of the paths case insensitive,
+	// the redirects must have been added with lower case paths
+	foldCase bool
+}
+
+// node is a node of the trie used to match paths with parameters
+type node struct {
+	static map[string]*node
+	param  *node
+
+	// set only on nodes where a path ends
+	redirect *Redirect
+	names    []string // parameters names, in order
+}
+
+const restPlaceholder = "{rest}"
+
+func newRouter(redirects []Redirect) (*router, error) {
+	rt := &router{
+		exact:     make(map[string]Redirect),
+		params:    &node{},
+		wildcards: make(map[string]Redirect),
+	}
+
+	for _, redirect := range redirects {
+		if err := rt.add(redirect); err != nil {
+			return nil, err
+		}
+	}
+
+	return rt, nil
+}
+
+// validatePath checks that path is one of the kinds
+// of paths supported by the router
+func validatePath(path string) error {
+	if i := strings.Index(path, "*"); i >= 0 {
+		if i != len(path)-1 || !strings.HasSuffix(path, "/*") {
+			return fmt.Errorf("invalid wildcard in path %s: only a trailing /* is allowed", path)
+		}
+		if strings.Contains(path, "/:") {
+			return fmt.Errorf("invalid wildcard in path %s: parameters are not allowed before it", path)
+		}
+		return nil
+	}
+
+	for _, segment := range strings.Split(path, "/") {
+		if strings.HasPrefix(segment, ":") && !isParamName(segment[1:]) {
+			return fmt.Errorf("invalid parameter %q in path %s", segment, path)
+		}
+	}
+
+	return nil
+}
+
+func (rt *router) add(redirect Redirect) error {
+	path := redirect.Path
+	if err := validatePath(path); err != nil {
+		return err
+	}
+
+	if strings.HasSuffix(path, "/*") {
+		prefix := strings.TrimSuffix(path, "*")
+		if _, ok := rt.wildcards[prefix]; ok {
+			return fmt.Errorf("path %s defined twice", path)
+		}
+		rt.wildcards[prefix] = redirect
+		return nil
+	}
+
+	if !strings.Contains(path, "/:") {
+		if _, ok := rt.exact[path]; ok {
+			return fmt.Errorf("path %s defined twice", path)
+		}
+		rt.exact[path] = redirect
+		return nil
+	}
+
+	n := rt.params
+	var names []string
+	for _, segment := range strings.Split(path, "/")[1:] {
+		if strings.HasPrefix(segment, ":") {
+			names = append(names, segment[1:])
+
+			if n.param == nil {
+				n.param = &node{}
+			}
+			n = n.param
+			continue
+		}
+
+		if n.static == nil {
+			n.static = make(map[string]*node)
+		}
+		child, ok := n.static[segment]
+		if !ok {
+			child = &node{}
+			n.static[segment] = child
+		}
+		n = child
+	}
+
+	if n.redirect != nil {
+		return fmt.Errorf("paths %s and %s match the same requests", n.redirect.Path, path)
+	}
+	n.redirect = &redirect
+	n.names = names
+
+	return nil
+}
+
+// lookup returns the Redirect matching path, with the placeholders
+// in its URL already replaced
+func (rt *router) lookup(path string) (Redirect, bool) {
+	if redirect, ok := rt.exact[rt.fold(path)]; ok {
+		return redirect, true
+	}
+
+	segments := strings.Split(path, "/")
+	if rt.params != nil && segments[0] == "" {
+		var values []string
+		if n := rt.params.match(segments[1:], &values, rt.fold); n != nil {
+			redirect := n.redirect.mapURLs(func(target string) string {
+				return replaceParams(target, n.names, values)
+			})
+			return redirect, true
+		}
+	}
+
+	// try the prefixes ending with '/' from the longest to the shortest
+	for i := len(path) - 1; i >= 0; i-- {
+		if path[i] != '/' {
+			continue
+		}
+
+		if redirect, ok := rt.wildcards[rt.fold(path[:i+1])]; ok {
+			rest := escapePath(path[i+1:])
+			redirect = redirect.mapURLs(func(target string) string {
+				return strings.Replace(target, restPlaceholder, rest, -1)
+			})
+			return redirect, true
+		}
+	}
+
+	return Redirect{}, false
+}
+
+// fold returns path in lower case if the router is case insensitive
+func (rt *router) fold(path string) string {
+	if rt.foldCase {
+		return strings.ToLower(path)
+	}
+	return path
+}
+
+// match walks the trie following segments, preferring static
+// segments over parameters, and returns the node where a path
+// ends or nil. The parameters values are appended to values.
+// The static segments are compared once passed to fold.
+func (n *node) match(segments []string, values *[]string, fold func(string) string) *node {
+	if len(segments) == 0 {
+		if n.redirect != nil {
+			return n
+		}
+		return nil
+	}
+
+	segment := segments[0]
+
+	if child, ok := n.static[fold(segment)]; ok {
+		if found := child.match(segments[1:], values, fold); found != nil {
+			return found
+		}
+	}
+
+	if n.param != nil && segment != "" {
+		*values = append(*values, segment)
+		if found := n.param.match(segments[1:], values, fold); found != nil {
+			return found
+		}
+		*values = (*values)[:len(*values)-1]
+	}
+
+	return nil
+}
+
+// replaceParams substitutes each :name placeholder in target
+// with the corresponding value
+func replaceParams(target string, names, values []string) string {
+	params := make(map[string]string, len(names))
+	for i, name := range names {
+		params[name] = url.PathEscape(values[i])
+	}
+
+	return substituteParams(target, params)
+}
+
+// substituteParams substitutes each :name placeholder in
+// target with params[name], as is
+func substituteParams(target string, params map[string]string) string {
+	var b strings.Builder
+	for i := 0; i < len(target); i++ {
+		if target[i] != ':' {
+			b.WriteByte(target[i])
+			continue
+		}
+
+		end := i + 1
+		for end < len(target) && isParamChar(target[end], end == i+1) {
+			end++
+		}
+
+		if value, ok := params[target[i+1:end]]; ok {
+			b.WriteString(value)
+			i = end - 1
+			continue
+		}
+
+		b.WriteByte(target[i])
+	}
+
+	return b.String()
+}
+
+// routeKey returns path with the names of its parameters left
+// out, the same for the paths matching the same requests
+func routeKey(path string) string {
+	if !strings.Contains(path, "/:") {
+		return path
+	}
+
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") {
+			segments[i] = ":"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// escapePath escapes each segment of path, leaving the slashes alone
+func escapePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+func isParamName(name string) bool {
+	if name == "" {
+		return false
+	}
+
+	for i := 0; i < len(name); i++ {
+		if !isParamChar(name[i], i == 0) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isParamChar(c byte, first bool) bool {
+	switch {
+	case c == '_', 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z':
+		return true
+	case '0' <= c && c <= '9':
+		return !first
+	}
+	return false
+}
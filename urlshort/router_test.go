@@ -0,0 +1,134 @@
+package urlshort
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRouterPrecedence(t *testing.T) {
+	rt, err := newRouter([]Redirect{
+		{Path: "/docs/*", URL: "https://site.com/docs/{rest}"},
+		{Path: "/docs/:page", URL: "https://site.com/pages/:page"},
+		{Path: "/docs/intro", URL: "https://site.com/intro"},
+		{Path: "/*", URL: "https://site.com/"},
+	})
+	if err != nil {
+		t.Fatalf("newRouter failed with error %v\n", err)
+	}
+
+	expected := map[string]string{
+		"/docs/intro":     "https://site.com/intro",
+		"/docs/faq":       "https://site.com/pages/faq",
+		"/docs/faq/index": "https://site.com/docs/faq/index",
+		"/docs/":          "https://site.com/docs/",
+		"/other":          "https://site.com/",
+	}
+	for path, location := range expected {
+		redirect, ok := rt.lookup(path)
+		if !ok {
+			t.Errorf("Expected %v to match\n", path)
+			continue
+		}
+		if redirect.URL != location {
+			t.Errorf("Expected %v to redirect to %v, got %v\n", path, location, redirect.URL)
+		}
+	}
+}
+
+func TestRouterParams(t *testing.T) {
+	rt, err := newRouter([]Redirect{
+		{Path: "/gh/:user/:repo", URL: "https://github.com/:user/:repo"},
+		{Path: "/gh/:user/issues/:id", URL: "https://github.com/:user/:user/issues/:id"},
+		{Path: "/gh/golang/go", URL: "https://go.dev"},
+	})
+	if err != nil {
+		t.Fatalf("newRouter failed with error %v\n", err)
+	}
+
+	expected := map[string]string{
+		"/gh/gophercises/urlshort": "https://github.com/gophercises/urlshort",
+		"/gh/golang/go":            "https://go.dev",
+		"/gh/golang/issues/42":     "https://github.com/golang/golang/issues/42",
+		"/gh/a b/repo":             "https://github.com/a%20b/repo",
+	}
+	for path, location := range expected {
+		redirect, ok := rt.lookup(path)
+		if !ok {
+			t.Errorf("Expected %v to match\n", path)
+			continue
+		}
+		if redirect.URL != location {
+			t.Errorf("Expected %v to redirect to %v, got %v\n", path, location, redirect.URL)
+		}
+	}
+
+	for _, path := range []string{"/gh/golang", "/gh/golang/go/extra", "/gh//go"} {
+		if redirect, ok := rt.lookup(path); ok {
+			t.Errorf("Expected %v not to match, got %v\n", path, redirect.URL)
+		}
+	}
+}
+
+func TestRouterInvalidPaths(t *testing.T) {
+	for _, path := range []string{"/docs/*/x", "/docs*", "/gh/:/x", "/gh/:1st", "/gh/:user/*"} {
+		if _, err := newRouter([]Redirect{{Path: path, URL: "https://site.com"}}); err == nil {
+			t.Errorf("Expected path %v to be rejected\n", path)
+		}
+	}
+}
+
+func TestRouterConflicts(t *testing.T) {
+	for _, paths := range [][]string{
+		{"/gh/:a", "/gh/:b"},
+		{"/gh/:user/x/:repo", "/gh/:owner/x/:name"},
+		{"/a", "/a"},
+		{"/docs/*", "/docs/*"},
+	} {
+		_, err := newRouter([]Redirect{
+			{Path: paths[0], URL: "https://site.com/1"},
+			{Path: paths[1], URL: "https://site.com/2"},
+		})
+		if err == nil {
+			t.Errorf("Expected %v to conflict\n", paths)
+		}
+	}
+
+	// different patterns don't
+	if _, err := newRouter([]Redirect{
+		{Path: "/gh/:a", URL: "https://site.com/1"},
+		{Path: "/gh/:a/:b", URL: "https://site.com/2"},
+		{Path: "/gh/x", URL: "https://site.com/3"},
+	}); err != nil {
+		t.Errorf("newRouter failed with error %v\n", err)
+	}
+
+	if _, err := DataHandler([]byte(`[
+		{"path": "/gh/:user", "url": "https://github.com/:user"},
+		{"path": "/gh/:org", "url": "https://github.com/orgs/:org"}
+	]`), "json", http.NotFoundHandler()); err == nil || !strings.Contains(err.Error(), "same requests") {
+		t.Errorf("Expected DataHandler to reject equivalent patterns, got %v\n", err)
+	}
+}
+
+func BenchmarkRouterLookup(b *testing.B) {
+	var redirects []Redirect
+	for i := 0; i < 5000; i++ {
+		redirects = append(redirects,
+			Redirect{Path: fmt.Sprintf("/exact/%d", i), URL: "https://site.com"},
+			Redirect{Path: fmt.Sprintf("/params/%d/:id", i), URL: "https://site.com/:id"},
+			Redirect{Path: fmt.Sprintf("/wildcard/%d/*", i), URL: "https://site.com/{rest}"},
+		)
+	}
+
+	rt, err := newRouter(redirects)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rt.lookup("/wildcard/4999/some/long/path")
+	}
+}
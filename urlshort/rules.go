@@ -0,0 +1,202 @@
+package urlshort
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Rule sends the requests matching its conditions to URL instead
+// of the default target of a link. A rule matches when each of its
+// conditions given holds, and a condition holds when the request
+// matches any of its values:
+//
+//	languages  the language preferred by the visitor, according to
+//	           the Accept-Language header, like "fr" (matching fr,
+//	           fr-FR, fr-CA...) or "pt-BR"
+//	devices    the device of the visitor, according to the
+//	           User-Agent header: "mobile", "desktop", "ios" or
+//	           "android"
+//	networks   the network of the client IP address, as a CIDR
+//	           range like "10.0.0.0/8" (see TrustProxies)
+type Rule struct {
+	Languages []string `yaml:"languages,omitempty" json:"languages,omitempty" toml:"languages,omitempty"`
+	Devices   []string `yaml:"devices,omitempty" json:"devices,omitempty" toml:"devices,omitempty"`
+	Networks  []string `yaml:"networks,omitempty" json:"networks,omitempty" toml:"networks,omitempty"`
+	URL       string   `yaml:"url" json:"url" toml:"url"`
+}
+
+var devices = []string{"mobile", "desktop", "ios", "android"}
+
+// TrustProxies makes the handlers read the client IP address matched
+// by the networks of the rules from the X-Forwarded-For header when
+// the requests come from one of proxies.
+func TrustProxies(proxies TrustedProxies) Option {
+	return func(o *options) {
+		o.proxies = proxies
+	}
+}
+
+// validateRules checks the rules of rd, if any
+func (rd Redirect) validateRules() error {
+	for i, rule := range rd.Rules {
+		target, err := url.Parse(rule.URL)
+		if err != nil {
+			return fmt.Errorf("invalid url for rule %d of path %s: %v", i+1, rd.Path, err)
+		}
+		if !target.IsAbs() || target.Host == "" {
+			return fmt.Errorf("url %s for rule %d of path %s is not absolute", rule.URL, i+1, rd.Path)
+		}
+
+		if len(rule.Languages) == 0 && len(rule.Devices) == 0 && len(rule.Networks) == 0 {
+			return fmt.Errorf("rule %d of path %s has no conditions", i+1, rd.Path)
+		}
+
+		for _, device := range rule.Devices {
+			if !contains(devices, strings.ToLower(device)) {
+				return fmt.Errorf("unknown device %q in rule %d of path %s, expected one of %s", device, i+1, rd.Path, strings.Join(devices, ", "))
+			}
+		}
+
+		for _, network := range rule.Networks {
+			if _, _, err := net.ParseCIDR(network); err != nil {
+				return fmt.Errorf("invalid network in rule %d of path %s: %v", i+1, rd.Path, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// applyRules returns redirect leading to the URL of the first of its
+// rules matching r, if any. The response is marked as varying with
+// the headers the rules depend on.
+func (o *options) applyRules(w http.ResponseWriter, r *http.Request, redirect Redirect) Redirect {
+	if len(redirect.Rules) == 0 {
+		return redirect
+	}
+	w.Header().Add("Vary", "Accept-Language, User-Agent")
+
+	for _, rule := range redirect.Rules {
+		if rule.matches(r, o.proxies) {
+			redirect.URL = rule.URL
+			redirect.Targets = nil
+			break
+		}
+	}
+
+	return redirect
+}
+
+func (rule Rule) matches(r *http.Request, proxies TrustedProxies) bool {
+	if len(rule.Languages) > 0 {
+		preferred := preferredLanguage(r.Header.Get("Accept-Language"))
+		matched := false
+		for _, language := range rule.Languages {
+			language = strings.ToLower(language)
+			matched = matched || preferred == language || strings.HasPrefix(preferred, language+"-")
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	if len(rule.Devices) > 0 {
+		matched := false
+		for _, device := range rule.Devices {
+			matched = matched || isDevice(r.UserAgent(), strings.ToLower(device))
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	if len(rule.Networks) > 0 {
+		ip := net.ParseIP(proxies.ClientIP(r))
+		matched := false
+		for _, network := range rule.Networks {
+			_, n, err := net.ParseCIDR(network)
+			matched = matched || (err == nil && ip != nil && n.Contains(ip))
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	return true
+}
+
+// preferredLanguage returns the language with the highest quality
+// in the Accept-Language header, in lower case, the first one if
+// several have the same
+func preferredLanguage(header string) string {
+	type language struct {
+		tag     string
+		quality float64
+	}
+
+	var languages []language
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		tag := strings.ToLower(strings.TrimSpace(fields[0]))
+		if tag == "" || tag == "*" {
+			continue
+		}
+
+		quality := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					quality = q
+				}
+			}
+		}
+
+		if quality > 0 {
+			languages = append(languages, language{tag, quality})
+		}
+	}
+
+	if len(languages) == 0 {
+		return ""
+	}
+
+	sort.SliceStable(languages, func(i, j int) bool {
+		return languages[i].quality > languages[j].quality
+	})
+	return languages[0].tag
+}
+
+// isDevice reports if the user agent ua runs on device
+func isDevice(ua, device string) bool {
+	ios := strings.Contains(ua, "iPhone") || strings.Contains(ua, "iPad") || strings.Contains(ua, "iPod")
+	android := strings.Contains(ua, "Android")
+	mobile := ios || android || strings.Contains(ua, "Mobi")
+
+	switch device {
+	case "ios":
+		return ios
+	case "android":
+		return android
+	case "mobile":
+		return mobile
+	case "desktop":
+		return !mobile
+	}
+
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+package urlshort
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRules(t *testing.T) {
+	data := []byte(`
+- path: /app/:id
+  url: https://example.com/app/:id
+  rules:
+    - devices: [ios]
+      url: https://apps.apple.com/app/:id
+    - devices: [android]
+      url: https://play.google.com/store/apps/details?id=:id
+    - languages: [fr, pt-BR]
+      devices: [desktop]
+      url: https://example.com/fr/app/:id
+    - networks: [10.0.0.0/8]
+      url: https://intranet.example.com/app/:id
+`)
+
+	proxies, err := ParseTrustedProxies([]string{"192.0.2.1"})
+	if err != nil {
+		t.Fatalf("ParseTrustedProxies failed with error %v\n", err)
+	}
+
+	h, err := DataHandler(data, "yaml", http.NotFoundHandler(), TrustProxies(proxies))
+	if err != nil {
+		t.Fatalf("DataHandler failed with error %v\n", err)
+	}
+
+	const (
+		iPhone  = "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 Mobile/15E148"
+		android = "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 Chrome/120.0 Mobile Safari/537.36"
+		desktop = "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 Chrome/120.0 Safari/537.36"
+	)
+
+	for _, test := range []struct {
+		userAgent, language, remote, forwarded string
+		location                               string
+	}{
+		{iPhone, "fr", "", "", "https://apps.apple.com/app/42"},
+		{android, "", "", "", "https://play.google.com/store/apps/details?id=42"},
+		{desktop, "fr-CA,en;q=0.8", "", "", "https://example.com/fr/app/42"},
+		{desktop, "en,pt-BR;q=0.9", "", "", "https://example.com/app/42"},
+		{desktop, "de;q=0.5,pt-br", "", "", "https://example.com/fr/app/42"},
+		{desktop, "", "10.1.2.3:1234", "", "https://intranet.example.com/app/42"},
+		{desktop, "", "192.0.2.1:1234", "10.1.2.3", "https://intranet.example.com/app/42"},
+		{desktop, "", "192.0.2.2:1234", "10.1.2.3", "https://example.com/app/42"},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/app/42", nil)
+		r.Header.Set("User-Agent", test.userAgent)
+		if test.language != "" {
+			r.Header.Set("Accept-Language", test.language)
+		}
+		if test.remote != "" {
+			r.RemoteAddr = test.remote
+		}
+		if test.forwarded != "" {
+			r.Header.Set("X-Forwarded-For", test.forwarded)
+		}
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if location := w.Header().Get("Location"); location != test.location {
+			t.Errorf("Expected %+v to redirect to %s, got %s\n", test, test.location, location)
+		}
+		if w.Header().Get("Vary") == "" {
+			t.Errorf("Expected a Vary header\n")
+		}
+	}
+}
+
+func TestRulesInvalid(t *testing.T) {
+	for _, data := range []string{
+		`[{"path": "/a", "url": "https://example.com", "rules": [{"url": "https://example.com/b"}]}]`,
+		`[{"path": "/a", "url": "https://example.com", "rules": [{"devices": ["fridge"], "url": "https://example.com/b"}]}]`,
+		`[{"path": "/a", "url": "https://example.com", "rules": [{"networks": ["10.0.0.0"], "url": "https://example.com/b"}]}]`,
+		`[{"path": "/a", "url": "https://example.com", "rules": [{"languages": ["fr"], "url": "relative"}]}]`,
+	} {
+		if _, err := DataHandler([]byte(data), "json", http.NotFoundHandler()); err == nil {
+			t.Errorf("Expected an error for %s\n", data)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package urlshort
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Option customizes the behaviour of the handlers
+// returned by this package
+type Option func(*options)
+
+type options struct {
+	preview  bool
+	denylist []string
+	counter  Counter
+	qr       bool
+	baseURL  string
+	metrics  *Metrics
+	store    string
+	proxies  TrustedProxies
+	params   map[string]string
+
+	normalization Normalization
+	chains        Chains
+}
+
+// defaultOptions are used by Redirect.ServeHTTP
+var defaultOptions = newOptions(nil)
+
+func newOptions(opts []Option) *options {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	if o.counter == nil {
+		o.counter = NewMemoryCounter()
+	}
+
+	return o
+}
+
+// Clicks sets the Counter used to record the clicks of the links,
+// and to disable the ones reaching their maximum number of clicks.
+// If not set, the clicks are kept in memory, and the links followed
+// a limited number of times can be followed again after a restart.
+func Clicks(c Counter) Option {
+	return func(o *options) {
+		o.counter = c
+	}
+}
+
+// Preview enables the preview mode: when a '+' is appended to
+// a short path, a page showing the destination of the link is
+// served instead of redirecting.
+func Preview() Option {
+	return func(o *options) {
+		o.preview = true
+	}
+}
+
+// Denylist makes the handlers serve a warning page instead of
+// redirecting to URLs whose host is one of domains, or one of
+// their subdomains.
+func Denylist(domains []string) Option {
+	return func(o *options) {
+		for _, domain := range domains {
+			domain = strings.ToLower(strings.Trim(strings.TrimSpace(domain), "."))
+			if domain != "" {
+				o.denylist = append(o.denylist, domain)
+			}
+		}
+	}
+}
+
+// handler returns an http.HandlerFunc serving the redirects
+// found by lookup, which must return ErrNotFound for unknown paths.
+// If the path is not found, or lookup returns an error, then the
+// fallback http.Handler will be called instead.
+// The errors are passed to onError, if not nil.
+func (o *options) handler(lookup func(path string) (Redirect, error), fallback http.Handler, onError func(error)) http.HandlerFunc {
+	if o.metrics != nil {
+		lookup = o.observed(lookup)
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		// the lookups fold the case themselves, so
+		// that the values of the parameters keep it
+		path := o.normalization.clean(r.URL.Path)
+
+		// before the path itself, that parameters
+		// and wildcards would match as well
+		if short, ok := o.qrPath(path); ok {
+			if redirect, err := lookup(short); err == nil {
+				matched(r, redirect.Path)
+				o.serveQR(w, r, short)
+				return
+			}
+		}
+		if o.preview && strings.HasSuffix(path, "+") {
+			if redirect, err := lookup(strings.TrimSuffix(path, "+")); err == nil {
+				o.serve(w, r, redirect, true)
+				return
+			}
+		}
+
+		redirect, err := lookup(path)
+		if err == nil {
+			o.serve(w, r, redirect, false)
+			return
+		}
+
+		if err != ErrNotFound && onError != nil {
+			onError(err)
+		}
+
+		fallback.ServeHTTP(w, r)
+	}
+}
+
+// observed returns lookup recording its latency and errors in o.metrics
+func (o *options) observed(lookup func(path string) (Redirect, error)) func(path string) (Redirect, error) {
+	return func(path string) (Redirect, error) {
+		start := now()
+		redirect, err := lookup(path)
+		o.metrics.observeLookup(o.store, now().Sub(start), err)
+
+		return redirect, err
+	}
+}
+
+// serve answers a request matching redirect, showing the
+// preview page instead of redirecting if preview is true
+func (o *options) serve(w http.ResponseWriter, r *http.Request, redirect Redirect, preview bool) {
+	matched(r, redirect.Path)
+
+	if redirect.expired() || redirect.Disabled {
+		http.Error(w, "410 gone", http.StatusGone)
+		return
+	}
+
+	exhausted, err := o.exhausted(redirect)
+	if err != nil {
+		http.Error(w, "503 service unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	if exhausted {
+		http.Error(w, "410 gone", http.StatusGone)
+		return
+	}
+
+	if !unlocked(w, r, redirect) {
+		return
+	}
+
+	redirect = o.applyRules(w, r, redirect)
+	redirect = o.withDefaultParams(redirect)
+	redirect, variant := pickTarget(w, r, redirect)
+	location := redirect.location(r)
+
+	// the pages showing the location count as a click of the links
+	// followed a limited number of times, or they could be read at will
+	denied := o.denied(location)
+	shown := denied || preview || redirect.Preview
+	if !shown || redirect.maxClicks() > 0 {
+		allowed, err := o.click(redirect)
+		if err != nil && !allowed {
+			http.Error(w, "503 service unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		if !allowed {
+			http.Error(w, "410 gone", http.StatusGone)
+			return
+		}
+		if variant != "" {
+			// the clicks of the link are what matters, this
+			// count is only informative and can be lost
+			o.counter.Incr(variantKey(redirect.Path, variant))
+		}
+	}
+
+	if denied {
+		renderPage(w, warningPage, redirect, location)
+		return
+	}
+
+	if preview || redirect.Preview {
+		renderPage(w, previewPage, redirect, location)
+		return
+	}
+
+	if r.Method == http.MethodPost && redirect.Password != "" {
+		// the password form has been submitted, the
+		// browser must follow the redirect with a GET
+		redirect.Status = http.StatusSeeOther
+	}
+
+	redirect.redirect(w, location)
+}
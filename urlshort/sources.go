@@ -0,0 +1,155 @@
+package urlshort
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Source describes where a set of redirects is read from: a file in
+// one of the formats supported by DataHandler, or the environment.
+//
+// If Format is "env", the redirects are read from the environment
+// variables whose name starts with Path, each one in the format:
+//
+//	URLSHORT_SOME_NAME="/some-path https://www.some-url.com/demo"
+//
+// Otherwise Path is the name of the file and, if Format is empty,
+// the format is detected from the file extension.
+type Source struct {
+	Path   string
+	Format string
+}
+
+// ParseSource parses the description of a Source: "env:PREFIX"
+// selects the environment variables starting with PREFIX, anything
+// else is the path of a file in the given format.
+func ParseSource(s, format string) Source {
+	if strings.HasPrefix(s, "env:") {
+		return Source{Path: strings.TrimPrefix(s, "env:"), Format: "env"}
+	}
+
+	return Source{Path: s, Format: format}
+}
+
+func (s Source) String() string {
+	if s.Format == "env" {
+		return "env:" + s.Path
+	}
+	return s.Path
+}
+
+func (s Source) load() ([]Redirect, error) {
+	if s.Format == "env" {
+		return parseEnv(os.Environ(), s.Path)
+	}
+
+	format := s.Format
+	if format == "" {
+		var err error
+		if format, err = FormatFromPath(s.Path); err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := ioutil.ReadFile(s.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	redirects, err := parseData(data, format)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", s, err)
+	}
+
+	return redirects, nil
+}
+
+// Conflict reports a path defined in more than one source
+type Conflict struct {
+	Path     string
+	Source   Source // the source whose redirect is used
+	Shadowed Source // the source whose redirect is ignored
+}
+
+func (c Conflict) String() string {
+	return fmt.Sprintf("path %s from %s is shadowed by %s", c.Path, c.Shadowed, c.Source)
+}
+
+// LoadSources reads the redirects from all the sources, given in
+// decreasing priority order, and merges them in a single table.
+// When a path is defined in more than one source, even with other
+// parameter names, the redirect from the first one is used and a
+// Conflict is reported.
+// If any of the sources can't be read or is invalid, an error
+// is returned.
+func LoadSources(sources []Source) ([]Redirect, []Conflict, error) {
+	var merged []Redirect
+	var conflicts []Conflict
+	definedBy := make(map[string]Source)
+
+	for _, source := range sources {
+		redirects, err := source.load()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, redirect := range redirects {
+			key := routeKey(redirect.Path)
+			if winner, ok := definedBy[key]; ok {
+				conflicts = append(conflicts, Conflict{
+					Path:     redirect.Path,
+					Source:   winner,
+					Shadowed: source,
+				})
+				continue
+			}
+
+			definedBy[key] = source
+			merged = append(merged, redirect)
+		}
+	}
+
+	return merged, conflicts, nil
+}
+
+// parseEnv reads the redirects from the variables in environ
+// whose name starts with prefix
+func parseEnv(environ []string, prefix string) ([]Redirect, error) {
+	var names []string
+	values := make(map[string]string)
+
+	for _, variable := range environ {
+		i := strings.Index(variable, "=")
+		if i < 0 || !strings.HasPrefix(variable[:i], prefix) {
+			continue
+		}
+
+		names = append(names, variable[:i])
+		values[variable[:i]] = variable[i+1:]
+	}
+	sort.Strings(names)
+
+	var redirects []Redirect
+	for _, name := range names {
+		fields := strings.Fields(values[name])
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("variable %s: expected \"<path> <url>\", got %q", name, values[name])
+		}
+
+		redirect := Redirect{Path: fields[0], URL: fields[1]}
+		if err := redirect.validate(); err != nil {
+			return nil, fmt.Errorf("variable %s: %v", name, err)
+		}
+
+		redirects = append(redirects, redirect)
+	}
+
+	if err := validate(redirects); err != nil {
+		return nil, fmt.Errorf("env:%s: %v", prefix, err)
+	}
+
+	return redirects, nil
+}
@@ -0,0 +1,150 @@
+package urlshort
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseDataTOML(t *testing.T) {
+	data := `
+[[redirect]]
+path = "/a"
+url = "https://example.com/a"
+
+[[redirect]]
+path = "/b"
+url = "https://example.com/b"
+status = 301
+expires = 2030-01-01T00:00:00Z
+`
+	redirects, err := parseData([]byte(data), "toml")
+	if err != nil {
+		t.Fatalf("parseData failed with error %v\n", err)
+	}
+
+	if len(redirects) != 2 {
+		t.Fatalf("Expected 2 redirects, got %v\n", len(redirects))
+	}
+	if redirects[1].Status != 301 || redirects[1].Expires == nil {
+		t.Errorf("Expected status and expiry to be set, got %+v\n", redirects[1])
+	}
+}
+
+func TestParseDataCSV(t *testing.T) {
+	data := "path,url\n/a, https://example.com/a\n/b,https://example.com/b\n"
+
+	redirects, err := parseData([]byte(data), "csv")
+	if err != nil {
+		t.Fatalf("parseData failed with error %v\n", err)
+	}
+
+	expected := []Redirect{
+		{Path: "/a", URL: "https://example.com/a"},
+		{Path: "/b", URL: "https://example.com/b"},
+	}
+	if len(redirects) != len(expected) {
+		t.Fatalf("Expected %v redirects, got %v\n", len(expected), len(redirects))
+	}
+	for i, redirect := range redirects {
+		if !reflect.DeepEqual(redirect, expected[i]) {
+			t.Errorf("Expected redirect %v to be %v, got %v\n", i, expected[i], redirect)
+		}
+	}
+
+	if _, err := parseData([]byte("/a,https://example.com,extra\n"), "csv"); err == nil {
+		t.Errorf("Expected parseData to fail with three columns\n")
+	}
+}
+
+func TestFormatFromPath(t *testing.T) {
+	expected := map[string]string{
+		"redirects.yml":  "yaml",
+		"redirects.YAML": "yaml",
+		"redirects.json": "json",
+		"redirects.toml": "toml",
+		"redirects.csv":  "csv",
+	}
+	for path, format := range expected {
+		if got, err := FormatFromPath(path); err != nil || got != format {
+			t.Errorf("Expected format %v for %v, got %v (%v)\n", format, path, got, err)
+		}
+	}
+
+	if _, err := FormatFromPath("redirects.txt"); err == nil {
+		t.Errorf("Expected FormatFromPath to fail on unknown extension\n")
+	}
+}
+
+func TestLoadSourcesConflicts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "urlshort")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	first := filepath.Join(dir, "first.csv")
+	writeFile(t, first, "/a,https://first.com/a\n/gh/:user,https://first.com/:user\n")
+	second := filepath.Join(dir, "second.json")
+	writeFile(t, second, `[
+		{"path": "/a", "url": "https://second.com/a"},
+		{"path": "/b", "url": "https://second.com/b"},
+		{"path": "/gh/:org", "url": "https://second.com/:org"}
+	]`)
+
+	os.Setenv("URLSHORT_TEST_C", "/c https://env.com/c")
+	os.Setenv("URLSHORT_TEST_B", "/b https://env.com/b")
+	defer os.Unsetenv("URLSHORT_TEST_C")
+	defer os.Unsetenv("URLSHORT_TEST_B")
+
+	sources := []Source{
+		ParseSource(first, ""),
+		ParseSource("env:URLSHORT_TEST_", ""),
+		ParseSource(second, ""),
+	}
+
+	redirects, conflicts, err := LoadSources(sources)
+	if err != nil {
+		t.Fatalf("LoadSources failed with error %v\n", err)
+	}
+
+	expected := map[string]string{
+		"/a": "https://first.com/a",
+		"/b": "https://env.com/b",
+		"/c": "https://env.com/c",
+
+		"/gh/:user": "https://first.com/:user",
+	}
+	if len(redirects) != len(expected) {
+		t.Errorf("Expected %v redirects, got %v\n", len(expected), redirects)
+	}
+	for _, redirect := range redirects {
+		if expected[redirect.Path] != redirect.URL {
+			t.Errorf("Expected %v to redirect to %v, got %v\n", redirect.Path, expected[redirect.Path], redirect.URL)
+		}
+	}
+
+	expectedConflicts := []Conflict{
+		{Path: "/a", Source: sources[0], Shadowed: sources[2]},
+		{Path: "/b", Source: sources[1], Shadowed: sources[2]},
+		{Path: "/gh/:org", Source: sources[0], Shadowed: sources[2]},
+	}
+	if len(conflicts) != len(expectedConflicts) {
+		t.Fatalf("Expected conflicts %v, got %v\n", expectedConflicts, conflicts)
+	}
+	for i, conflict := range conflicts {
+		if conflict != expectedConflicts[i] {
+			t.Errorf("Expected conflict %v, got %v\n", expectedConflicts[i], conflict)
+		}
+	}
+}
+
+func TestParseEnvInvalid(t *testing.T) {
+	environ := []string{"URLSHORT_A=/a"}
+
+	if _, err := parseEnv(environ, "URLSHORT_"); err == nil {
+		t.Errorf("Expected parseEnv to fail on a variable without url\n")
+	}
+}
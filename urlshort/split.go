@@ -0,0 +1,166 @@
+package urlshort
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// Target is one of the destinations of a link splitting its
+// traffic, receiving a share of the visitors proportional to its
+// Weight, 1 if zero. Name identifies it in the clicks and in the
+// cookie keeping each visitor on the same target, it defaults to
+// its position in the list, starting from 1.
+type Target struct {
+	Name   string `yaml:"name,omitempty" json:"name,omitempty" toml:"name,omitempty"`
+	URL    string `yaml:"url" json:"url" toml:"url"`
+	Weight int    `yaml:"weight,omitempty" json:"weight,omitempty" toml:"weight,omitempty"`
+}
+
+// variantAge is how long a visitor is kept on the same target
+const variantAge = 30 * 24 * 60 * 60
+
+// randIntn is used to pick the targets,
+// it can be replaced by tests
+var randIntn = rand.Intn
+
+// name returns the name of the target at position i
+func (t Target) name(i int) string {
+	if t.Name == "" {
+		return strconv.Itoa(i + 1)
+	}
+	return t.Name
+}
+
+// TargetNames returns the names of the targets of rd, in order
+func (rd Redirect) TargetNames() []string {
+	names := make([]string, len(rd.Targets))
+	for i, t := range rd.Targets {
+		names[i] = t.name(i)
+	}
+	return names
+}
+
+func (t Target) weight() int {
+	if t.Weight == 0 {
+		return 1
+	}
+	return t.Weight
+}
+
+// validateTargets checks the targets of rd, if any
+func (rd Redirect) validateTargets() error {
+	names := make(map[string]bool, len(rd.Targets))
+	for i, t := range rd.Targets {
+		target, err := url.Parse(t.URL)
+		if err != nil {
+			return fmt.Errorf("invalid url for target %d of path %s: %v", i+1, rd.Path, err)
+		}
+		if !target.IsAbs() || target.Host == "" {
+			return fmt.Errorf("url %s for target %d of path %s is not absolute", t.URL, i+1, rd.Path)
+		}
+
+		if t.Weight < 0 {
+			return fmt.Errorf("negative weight for target %d of path %s", i+1, rd.Path)
+		}
+
+		name := t.name(i)
+		if names[name] {
+			return fmt.Errorf("target name %s defined twice for path %s", name, rd.Path)
+		}
+		names[name] = true
+	}
+
+	return nil
+}
+
+// mapURLs returns rd with f applied to its URL and to the ones of
+// its targets and rules, leaving the ones of rd alone
+func (rd Redirect) mapURLs(f func(string) string) Redirect {
+	rd.URL = f(rd.URL)
+
+	if rd.Targets != nil {
+		targets := make([]Target, len(rd.Targets))
+		for i, t := range rd.Targets {
+			t.URL = f(t.URL)
+			targets[i] = t
+		}
+		rd.Targets = targets
+	}
+
+	if rd.Rules != nil {
+		rules := make([]Rule, len(rd.Rules))
+		for i, rule := range rd.Rules {
+			rule.URL = f(rule.URL)
+			rules[i] = rule
+		}
+		rd.Rules = rules
+	}
+
+	return rd
+}
+
+// pickTarget returns redirect with the URL of one of its targets,
+// along with its name, keeping the visitor on the target picked
+// for it before, if any, with a cookie. Redirects without targets
+// are returned as they are, with an empty name.
+func pickTarget(w http.ResponseWriter, r *http.Request, redirect Redirect) (Redirect, string) {
+	if len(redirect.Targets) == 0 {
+		return redirect, ""
+	}
+
+	cookie := variantCookie(redirect.Path)
+	picked := -1
+	if c, err := r.Cookie(cookie); err == nil {
+		for i, t := range redirect.Targets {
+			if t.name(i) == c.Value {
+				picked = i
+			}
+		}
+	}
+
+	if picked < 0 {
+		total := 0
+		for _, t := range redirect.Targets {
+			total += t.weight()
+		}
+
+		n := randIntn(total)
+		for i, t := range redirect.Targets {
+			if n -= t.weight(); n < 0 {
+				picked = i
+				break
+			}
+		}
+
+		http.SetCookie(w, &http.Cookie{
+			Name:     cookie,
+			Value:    redirect.Targets[picked].name(picked),
+			Path:     "/",
+			MaxAge:   variantAge,
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+
+	target := redirect.Targets[picked]
+	redirect.URL = target.URL
+	return redirect, target.name(picked)
+}
+
+// variantCookie returns the name of the cookie keeping
+// the target picked for the link of path
+func variantCookie(path string) string {
+	h := fnv.New32a()
+	h.Write([]byte(path))
+	return fmt.Sprintf("urlshort_%08x", h.Sum32())
+}
+
+// variantKey returns the key of the clicks of
+// a target in the Counter of the link of path
+func variantKey(path, name string) string {
+	return path + "#" + name
+}
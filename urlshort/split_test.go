@@ -0,0 +1,88 @@
+package urlshort
+
+import (
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSplitTargets(t *testing.T) {
+	defer func() { randIntn = rand.Intn }()
+
+	data := []byte(`
+- path: /signup
+  targets:
+    - name: current
+      url: https://example.com/signup
+      weight: 90
+    - name: new
+      url: https://example.com/signup-v2
+      weight: 10
+- path: /gh/:user
+  targets:
+    - url: https://github.com/:user
+    - url: https://gitlab.com/:user
+`)
+
+	counter := NewMemoryCounter()
+	h, err := DataHandler(data, "yaml", http.NotFoundHandler(), Clicks(counter))
+	if err != nil {
+		t.Fatalf("DataHandler failed with error %v\n", err)
+	}
+
+	// the last 10 of the 100 shares go to the new signup
+	randIntn = func(n int) int { return 95 }
+
+	r := httptest.NewRequest(http.MethodGet, "/signup", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if location := w.Header().Get("Location"); location != "https://example.com/signup-v2" {
+		t.Errorf("Expected the new signup to be picked, got %v\n", location)
+	}
+
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Value != "new" {
+		t.Fatalf("Expected a cookie keeping the new signup, got %v\n", cookies)
+	}
+
+	// the visitor stays on the same target
+	randIntn = func(n int) int { return 0 }
+
+	for i := 0; i < 2; i++ {
+		r = httptest.NewRequest(http.MethodGet, "/signup", nil)
+		r.AddCookie(cookies[0])
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if location := w.Header().Get("Location"); location != "https://example.com/signup-v2" {
+			t.Errorf("Expected the visitor to stay on the new signup, got %v\n", location)
+		}
+		if len(w.Result().Cookies()) != 0 {
+			t.Errorf("Expected the cookie not to be set again\n")
+		}
+	}
+
+	expectLocation(t, h, "/signup", "https://example.com/signup")
+	expectLocation(t, h, "/gh/gopher", "https://github.com/gopher")
+
+	link, err := CountClicks(Redirect{Path: "/signup", Targets: []Target{{Name: "current"}, {Name: "new"}}}, counter)
+	if err != nil {
+		t.Fatalf("CountClicks failed with error %v\n", err)
+	}
+	if link.Clicks != 4 || link.Variants["current"] != 1 || link.Variants["new"] != 3 {
+		t.Errorf("Expected 4 clicks, 1 on current and 3 on new, got %+v\n", link)
+	}
+}
+
+func TestSplitTargetsInvalid(t *testing.T) {
+	for _, data := range []string{
+		`[{"path": "/a", "url": "https://example.com", "targets": [{"url": "https://example.com/b"}]}]`,
+		`[{"path": "/a", "targets": [{"url": "relative"}]}]`,
+		`[{"path": "/a", "targets": [{"url": "https://example.com/a", "weight": -1}]}]`,
+		`[{"path": "/a", "targets": [{"url": "https://example.com/a"}, {"name": "1", "url": "https://example.com/b"}]}]`,
+	} {
+		if _, err := DataHandler([]byte(data), "json", http.NotFoundHandler()); err == nil {
+			t.Errorf("Expected an error for %s\n", data)
+		}
+	}
+}
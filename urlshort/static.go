@@ -0,0 +1,293 @@
+package urlshort
+
+import (
+	"bufio"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Skipped is a redirect left out of a static export
+type Skipped struct {
+	Path   string
+	Reason string
+}
+
+func (s Skipped) String() string {
+	return fmt.Sprintf("%s: %s", s.Path, s.Reason)
+}
+
+// StaticFormats are the formats supported by ExportStatic
+var StaticFormats = []string{"nginx", "apache", "netlify"}
+
+// ExportStatic writes redirects to w as the configuration of a
+// static web server, so that they can be served without this
+// package. The formats are:
+//
+//	nginx    location blocks with return directives, to be
+//	         included in a server block
+//	apache   RewriteRules, for an .htaccess file at the root
+//	netlify  Netlify _redirects file
+//
+// The redirects are written in order of precedence. The ones that
+// can't be served statically, because they are disabled, expired or
+// protected by a password, a preview page or a limit of clicks, are
+// left out and returned with the reason.
+func ExportStatic(w io.Writer, redirects []Redirect, format string) ([]Skipped, error) {
+	bw := bufio.NewWriter(w)
+
+	var write func(w io.Writer, rd Redirect) error
+	switch format {
+	case "nginx":
+		write = writeNginx
+	case "apache":
+		write = writeApache
+		fmt.Fprintln(bw, "RewriteEngine On")
+	case "netlify":
+		write = writeNetlify
+	default:
+		return nil, fmt.Errorf("unsupported static format %s", format)
+	}
+
+	exported, skipped := staticRedirects(redirects)
+	for _, rd := range exported {
+		if err := write(bw, rd); err != nil {
+			skipped = append(skipped, Skipped{rd.Path, err.Error()})
+		}
+	}
+
+	return skipped, bw.Flush()
+}
+
+// ExportPages writes to dir an HTML page for each redirect, sending
+// the browsers to its URL with a meta refresh: the page of /docs is
+// dir/docs/index.html, so that any static host can serve it.
+// The redirects that can't be served statically, including the ones
+// with parameters or wildcards, are left out and returned with the
+// reason.
+func ExportPages(dir string, redirects []Redirect) ([]Skipped, error) {
+	exported, skipped := staticRedirects(redirects)
+
+	for _, rd := range exported {
+		if isTemplate(rd.Path) {
+			skipped = append(skipped, Skipped{rd.Path, "paths with parameters or wildcards need a server"})
+			continue
+		}
+
+		segments := strings.Split(strings.Trim(rd.Path, "/"), "/")
+		for _, segment := range segments {
+			if segment == "." || segment == ".." || strings.ContainsAny(segment, `\`) {
+				return skipped, fmt.Errorf("unsafe path %s", rd.Path)
+			}
+		}
+
+		pageDir := filepath.Join(append([]string{dir}, segments...)...)
+		if err := os.MkdirAll(pageDir, 0755); err != nil {
+			return skipped, err
+		}
+
+		f, err := os.Create(filepath.Join(pageDir, "index.html"))
+		if err != nil {
+			return skipped, err
+		}
+
+		err = refreshPage.Execute(f, rd)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return skipped, err
+		}
+	}
+
+	return skipped, nil
+}
+
+var refreshPage = template.Must(template.New("refresh").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{if .Title}}{{.Title}}{{else}}Redirecting{{end}}</title>
+<meta name="robots" content="noindex">
+<meta http-equiv="refresh" content="0; url={{.URL}}">
+<link rel="canonical" href="{{.URL}}">
+</head>
+<body>
+<p>Redirecting to <a href="{{.URL}}">{{.URL}}</a>.</p>
+</body>
+</html>
+`))
+
+// staticRedirects returns the redirects that can be served
+// statically, in order of precedence, and the skipped ones
+func staticRedirects(redirects []Redirect) ([]Redirect, []Skipped) {
+	var exported []Redirect
+	var skipped []Skipped
+
+	for _, rd := range redirects {
+		var reason string
+		switch {
+		case rd.Disabled:
+			reason = "disabled"
+		case rd.expired():
+			reason = "expired"
+		case rd.Expires != nil:
+			reason = "expiring links need a server"
+		case rd.Password != "":
+			reason = "password protected links need a server"
+		case rd.maxClicks() > 0:
+			reason = "links with a limit of clicks need a server"
+		case rd.Preview:
+			reason = "links with a preview page need a server"
+		case len(rd.Targets) > 0:
+			reason = "links split among several targets need a server"
+		case len(rd.Rules) > 0:
+			reason = "links with conditional rules need a server"
+		}
+
+		if reason != "" {
+			skipped = append(skipped, Skipped{rd.Path, reason})
+			continue
+		}
+
+		rd.URL = addParams(rd.URL, rd.Params)
+		exported = append(exported, rd)
+	}
+
+	sort.SliceStable(exported, func(i, j int) bool {
+		return precedence(exported[i].Path) < precedence(exported[j].Path)
+	})
+
+	return exported, skipped
+}
+
+// precedence orders the paths as the router matches them: exact
+// paths, then paths with parameters, then wildcards from the longest
+func precedence(path string) int {
+	switch {
+	case strings.HasSuffix(path, "/*"):
+		return 1<<20 - len(path)
+	case strings.Contains(path, "/:"):
+		return 1
+	}
+	return 0
+}
+
+func isTemplate(path string) bool {
+	return strings.HasSuffix(path, "/*") || strings.Contains(path, "/:")
+}
+
+// pathRegexp returns the regular expression matching the path of rd,
+// without anchors, along with the target with its placeholders
+// replaced by the references to the groups, made by ref
+func pathRegexp(rd Redirect, ref func(group int) string) (string, string) {
+	var pattern strings.Builder
+	params := make(map[string]string)
+	target := rd.URL
+
+	segments := strings.Split(rd.Path, "/")[1:]
+	for i, segment := range segments {
+		pattern.WriteString("/")
+
+		switch {
+		case segment == "*" && i == len(segments)-1:
+			pattern.WriteString("(.*)")
+			target = strings.Replace(target, restPlaceholder, ref(len(params)+1), -1)
+		case strings.HasPrefix(segment, ":"):
+			pattern.WriteString("([^/]+)")
+			params[segment[1:]] = ref(len(params) + 1)
+		default:
+			pattern.WriteString(regexp.QuoteMeta(segment))
+		}
+	}
+
+	return pattern.String(), substituteParams(target, params)
+}
+
+// nginxQuote returns s as a quoted nginx string, or an error
+// if it contains a '$' that would be taken as a variable
+func nginxQuote(s string) (string, error) {
+	if strings.Contains(s, "$") {
+		return "", fmt.Errorf("nginx can't return %s, it contains '$'", s)
+	}
+	return nginxString(s), nil
+}
+
+// nginxString returns s quoted, without interpreting its variables
+func nginxString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+func writeNginx(w io.Writer, rd Redirect) error {
+	if strings.Contains(rd.URL, "$") {
+		return fmt.Errorf("nginx can't return %s, it contains '$'", rd.URL)
+	}
+
+	if !isTemplate(rd.Path) {
+		path, err := nginxQuote(rd.Path)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(w, "location = %s { return %d %s; }\n", path, rd.status(), nginxString(nginxTarget(rd, rd.URL)))
+		return nil
+	}
+
+	pattern, target := pathRegexp(rd, func(group int) string {
+		return "$" + strconv.Itoa(group)
+	})
+	fmt.Fprintf(w, "location ~ %s { return %d %s; }\n", nginxString("^"+pattern+"$"), rd.status(), nginxString(nginxTarget(rd, target)))
+
+	return nil
+}
+
+// nginxTarget appends the query of the request
+// to target if rd preserves it
+func nginxTarget(rd Redirect, target string) string {
+	if !rd.PreserveQuery {
+		return target
+	}
+
+	if strings.Contains(rd.URL, "?") {
+		return target + "&$args"
+	}
+	return target + "$is_args$args"
+}
+
+func writeApache(w io.Writer, rd Redirect) error {
+	// a literal '$' would be taken as a back-reference
+	rd.URL = strings.Replace(rd.URL, "$", `\$`, -1)
+	pattern, target := pathRegexp(rd, func(group int) string {
+		return "$" + strconv.Itoa(group)
+	})
+
+	// the paths matched in .htaccess have no leading slash
+	pattern = "^" + strings.TrimPrefix(pattern, "/") + "$"
+	escape := strings.NewReplacer(" ", `\ `, "%", `\%`)
+
+	flags := fmt.Sprintf("R=%d,L,NE,QSD", rd.status())
+	if rd.PreserveQuery {
+		flags = fmt.Sprintf("R=%d,L,NE,QSA", rd.status())
+	}
+
+	fmt.Fprintf(w, "RewriteRule %s %s [%s]\n", escape.Replace(pattern), escape.Replace(target), flags)
+
+	return nil
+}
+
+func writeNetlify(w io.Writer, rd Redirect) error {
+	if strings.ContainsAny(rd.Path+rd.URL, " \t") {
+		return fmt.Errorf("netlify can't handle spaces in %s", rd.URL)
+	}
+
+	target := strings.Replace(rd.URL, restPlaceholder, ":splat", -1)
+	fmt.Fprintf(w, "%s  %s  %d\n", rd.Path, target, rd.status())
+
+	return nil
+}
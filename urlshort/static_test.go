@@ -0,0 +1,125 @@
+package urlshort
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var staticData = []byte(`[
+	{"path": "/docs/*", "url": "https://docs.example.com/{rest}"},
+	{"path": "/gh/:user", "url": "https://github.com/:user", "preserve_query": true},
+	{"path": "/", "url": "https://example.com", "status": 301},
+	{"path": "/once", "url": "https://example.com/once", "one_time": true},
+	{"path": "/off", "url": "https://example.com/off", "disabled": true}
+]`)
+
+func TestExportStatic(t *testing.T) {
+	redirects, err := parseData(staticData, "json")
+	if err != nil {
+		t.Fatalf("parseData failed with error %v\n", err)
+	}
+
+	for format, expected := range map[string]string{
+		"nginx": `location = "/" { return 301 "https://example.com"; }
+location ~ "^/gh/([^/]+)$" { return 302 "https://github.com/$1$is_args$args"; }
+location ~ "^/docs/(.*)$" { return 302 "https://docs.example.com/$1"; }
+`,
+		"apache": `RewriteEngine On
+RewriteRule ^$ https://example.com [R=301,L,NE,QSD]
+RewriteRule ^gh/([^/]+)$ https://github.com/$1 [R=302,L,NE,QSA]
+RewriteRule ^docs/(.*)$ https://docs.example.com/$1 [R=302,L,NE,QSD]
+`,
+		"netlify": `/  https://example.com  301
+/gh/:user  https://github.com/:user  302
+/docs/*  https://docs.example.com/:splat  302
+`,
+	} {
+		var b bytes.Buffer
+		skipped, err := ExportStatic(&b, redirects, format)
+		if err != nil {
+			t.Fatalf("ExportStatic failed with error %v\n", err)
+		}
+		if b.String() != expected {
+			t.Errorf("Expected the %s configuration\n%s\ngot\n%s\n", format, expected, b.String())
+		}
+		if len(skipped) != 2 || skipped[0].Path != "/once" || skipped[1].Path != "/off" {
+			t.Errorf("Expected /once and /off to be skipped, got %v\n", skipped)
+		}
+	}
+
+	if _, err := ExportStatic(ioutil.Discard, redirects, "caddy"); err == nil {
+		t.Errorf("Expected an error for an unsupported format\n")
+	}
+}
+
+func TestExportStaticParams(t *testing.T) {
+	redirects, err := parseData([]byte(`[
+		{"path": "/docs/*", "url": "https://docs.example.com/{rest}", "params": {"utm_source": "x"}},
+		{"path": "/gh/:user", "url": "https://github.com/:user#top", "params": {"utm_source": "x"}}
+	]`), "json")
+	if err != nil {
+		t.Fatalf("parseData failed with error %v\n", err)
+	}
+
+	for format, expected := range map[string]string{
+		"nginx": `location ~ "^/gh/([^/]+)$" { return 302 "https://github.com/$1?utm_source=x#top"; }
+location ~ "^/docs/(.*)$" { return 302 "https://docs.example.com/$1?utm_source=x"; }
+`,
+		"apache": `RewriteEngine On
+RewriteRule ^gh/([^/]+)$ https://github.com/$1?utm_source=x#top [R=302,L,NE,QSD]
+RewriteRule ^docs/(.*)$ https://docs.example.com/$1?utm_source=x [R=302,L,NE,QSD]
+`,
+		"netlify": `/gh/:user  https://github.com/:user?utm_source=x#top  302
+/docs/*  https://docs.example.com/:splat?utm_source=x  302
+`,
+	} {
+		var b bytes.Buffer
+		if _, err := ExportStatic(&b, redirects, format); err != nil {
+			t.Fatalf("ExportStatic failed with error %v\n", err)
+		}
+		if b.String() != expected {
+			t.Errorf("Expected the %s configuration\n%s\ngot\n%s\n", format, expected, b.String())
+		}
+	}
+}
+
+func TestExportPages(t *testing.T) {
+	dir, err := ioutil.TempDir("", "urlshort")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	redirects := []Redirect{
+		{Path: "/", URL: "https://example.com"},
+		{Path: "/docs/intro", URL: "https://example.com/?a=1&b=<2>"},
+		{Path: "/gh/:user", URL: "https://github.com/:user"},
+	}
+
+	skipped, err := ExportPages(dir, redirects)
+	if err != nil {
+		t.Fatalf("ExportPages failed with error %v\n", err)
+	}
+	if len(skipped) != 1 || skipped[0].Path != "/gh/:user" {
+		t.Errorf("Expected /gh/:user to be skipped, got %v\n", skipped)
+	}
+
+	page, err := ioutil.ReadFile(filepath.Join(dir, "docs", "intro", "index.html"))
+	if err != nil {
+		t.Fatalf("Expected the page of /docs/intro, got %v\n", err)
+	}
+	if !strings.Contains(string(page), `content="0; url=https://example.com/?a=1&amp;b=&lt;2&gt;"`) {
+		t.Errorf("Expected an escaped meta refresh, got\n%s\n", page)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "index.html")); err != nil {
+		t.Errorf("Expected the page of /, got %v\n", err)
+	}
+
+	if _, err := ExportPages(dir, []Redirect{{Path: "/../escape", URL: "https://example.com"}}); err == nil {
+		t.Errorf("Expected an error for a path leaving the directory\n")
+	}
+}
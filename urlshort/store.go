@@ -0,0 +1,181 @@
+package urlshort
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned by a Store when no redirect
+// is defined for the requested path
+var ErrNotFound = errors.New("redirect not found")
+
+// ErrUnavailable is returned by a Store that is temporarily
+// unable to reach its backend
+var ErrUnavailable = errors.New("store temporarily unavailable")
+
+// Store is the interface implemented by the backends
+// queried for the redirects on each request.
+//
+// Get returns the Redirect defined for path,
+// or ErrNotFound if there is none.
+type Store interface {
+	Get(path string) (Redirect, error)
+}
+
+// WritableStore is the interface implemented by the
+// stores whose redirects can be managed.
+//
+// List returns all the redirects, ordered by path.
+// Put creates the redirect, or replaces the one with the same path.
+// Delete removes the redirect for path, or returns ErrNotFound
+// if there is none.
+type WritableStore interface {
+	Store
+	List() ([]Redirect, error)
+	Put(redirect Redirect) error
+	Delete(path string) error
+}
+
+// PatternError is returned by the stores of ExactPaths when the
+// path of a redirect has parameters or a wildcard
+type PatternError struct {
+	Path string
+}
+
+func (e *PatternError) Error() string {
+	return fmt.Sprintf("path %s has parameters or a wildcard, only exact paths can be stored", e.Path)
+}
+
+// ExactPaths returns a WritableStore storing the redirects in store,
+// except the ones whose path has parameters or a wildcard, refused
+// with a *PatternError since StoreHandler would never match them.
+func ExactPaths(store WritableStore) WritableStore {
+	return exactStore{store}
+}
+
+type exactStore struct {
+	WritableStore
+}
+
+func (s exactStore) Put(redirect Redirect) error {
+	if isTemplate(redirect.Path) {
+		return &PatternError{Path: redirect.Path}
+	}
+	return s.WritableStore.Put(redirect)
+}
+
+// StoreHandler will return an http.HandlerFunc (which also
+// implements http.Handler) that will look up the path of each
+// request in store, redirecting to the corresponding URL.
+// Only exact paths are supported, which ExactPaths enforces. If the paths are normalized with
+// NormalizePaths, the paths in the store must be normalized too,
+// which NormalizeStore does.
+// If the path is not found in the store, or the store returns an
+// error, then the fallback http.Handler will be called instead.
+// The errors are passed to onError, if not nil.
+// The handler behaviour can be customized with opts.
+func StoreHandler(store Store, fallback http.Handler, onError func(error), opts ...Option) http.HandlerFunc {
+	o := newOptions(opts)
+
+	lookup := store.Get
+	if o.normalization.FoldCase {
+		lookup = func(path string) (Redirect, error) {
+			return store.Get(o.normalization.fold(path))
+		}
+	}
+
+	return o.handler(lookup, fallback, onError)
+}
+
+// CachedStore is a Store keeping in memory the results
+// of the lookups done on another Store for a while,
+// to avoid querying it on each request.
+// Both found and not found paths are cached, errors are not.
+type CachedStore struct {
+	store Store
+	ttl   time.Duration
+	size  int
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	redirect Redirect
+	err      error
+	expires  time.Time
+}
+
+// NewCachedStore returns a CachedStore caching up to size
+// lookups done on store for ttl.
+func NewCachedStore(store Store, ttl time.Duration, size int) *CachedStore {
+	return &CachedStore{
+		store:   store,
+		ttl:     ttl,
+		size:    size,
+		entries: make(map[string]cacheEntry),
+	}
+}
+
+// Get returns the cached result of the lookup of path,
+// querying the underlying Store if it's missing or expired.
+func (s *CachedStore) Get(path string) (Redirect, error) {
+	s.mu.Lock()
+	entry, ok := s.entries[path]
+	s.mu.Unlock()
+
+	if ok && now().Before(entry.expires) {
+		return entry.redirect, entry.err
+	}
+
+	redirect, err := s.store.Get(path)
+	if err != nil && err != ErrNotFound {
+		return redirect, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.entries) >= s.size {
+		s.evict()
+	}
+	if s.size > 0 {
+		s.entries[path] = cacheEntry{
+			redirect: redirect,
+			err:      err,
+			expires:  now().Add(s.ttl),
+		}
+	}
+
+	return redirect, err
+}
+
+// Forget removes path from the cache, so that the next
+// lookup will query the underlying Store.
+func (s *CachedStore) Forget(path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, path)
+}
+
+// evict makes room for a new entry, dropping the expired ones
+// or, if there are none, a random one
+func (s *CachedStore) evict() {
+	t := now()
+	for path, entry := range s.entries {
+		if !t.Before(entry.expires) {
+			delete(s.entries, path)
+		}
+	}
+
+	for path := range s.entries {
+		if len(s.entries) < s.size {
+			break
+		}
+		delete(s.entries, path)
+	}
+}